@@ -0,0 +1,137 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type checkedQuery struct {
+	sql  string
+	dest reflect.Type // struct the rows are scanned into
+}
+
+var (
+	checkedMu sync.Mutex
+	checked   = make(map[string]checkedQuery)
+)
+
+// Checked registers sql under name as a query whose rows are scanned into T with Get or Select,
+// so that CheckQueries verifies its result columns against T. It returns sql:
+//
+//	var listHoldings = dbx.Checked[Holdings]("ListHoldings", `SELECT * FROM holdings WHERE loc = $1`)
+func Checked[T any](name, sql string) string {
+	checkedMu.Lock()
+	checked[name] = checkedQuery{sql: sql, dest: reflect.TypeFor[T]()}
+	checkedMu.Unlock()
+	return sql
+}
+
+// CheckQueries prepares queries, a map of names to SQL, and the queries registered with Checked
+// on the package-level connection. It reports queries that do not prepare, e.g. because a
+// migration renamed a column, and registered queries whose result columns cannot be scanned
+// into their struct. All problems are returned together.
+func CheckQueries(ctx context.Context, queries map[string]string) error {
+	c := current()
+	if c == nil {
+		return errors.New("dbx: not connected")
+	}
+
+	all := make(map[string]checkedQuery, len(queries))
+	checkedMu.Lock()
+	for name, q := range checked {
+		all[name] = q
+	}
+	checkedMu.Unlock()
+	for name, sql := range queries {
+		q := all[name]
+		if q.sql != sql {
+			q = checkedQuery{sql: sql}
+		}
+		all[name] = q
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	typeNames := make(map[uint32]string)
+	for i, name := range names {
+		q := all[name]
+		stmt := fmt.Sprintf("dbx_check_%d", i)
+		desc, err := c.Prepare(ctx, stmt, q.sql)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dbx: query %s: %w", name, err))
+			continue
+		}
+		if q.dest != nil {
+			if err := checkColumns(ctx, desc.Fields, q.dest, typeNames); err != nil {
+				errs = append(errs, fmt.Errorf("dbx: query %s: %w", name, err))
+			}
+		}
+		if err := c.Deallocate(ctx, stmt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkColumns verifies that the result columns fields can be scanned into the fields of dest
+// mapped to them. Nullability is only known for columns read directly from a table.
+func checkColumns(ctx context.Context, fields []pgconn.FieldDescription, dest reflect.Type, typeNames map[uint32]string) error {
+	for dest.Kind() == reflect.Pointer {
+		dest = dest.Elem()
+	}
+	if dest.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not a struct", dest)
+	}
+	byColumn := make(map[string]reflect.StructField)
+	for i := 0; i < dest.NumField(); i++ {
+		if name, _, ok := fieldColumn(dest.Field(i)); ok {
+			byColumn[name] = dest.Field(i)
+		}
+	}
+
+	var problems []string
+	for _, fd := range fields {
+		field, ok := byColumn[fd.Name]
+		if !ok {
+			continue
+		}
+		typeName, ok := typeNames[fd.DataTypeOID]
+		if !ok {
+			if err := current().QueryRow(ctx, "SELECT typname FROM pg_type WHERE oid = $1", fd.DataTypeOID).Scan(&typeName); err != nil {
+				return err
+			}
+			typeNames[fd.DataTypeOID] = typeName
+		}
+		if !compatible(field.Type, typeName) {
+			problems = append(problems, fmt.Sprintf("field %s: %s cannot hold column %q of type %s", field.Name, field.Type, fd.Name, typeName))
+			continue
+		}
+		if fd.TableOID != 0 && !nullable(field.Type) {
+			var notNull bool
+			err := current().QueryRow(ctx, "SELECT attnotnull FROM pg_attribute WHERE attrelid = $1 AND attnum = $2",
+				fd.TableOID, fd.TableAttributeNumber).Scan(&notNull)
+			if err != nil {
+				return err
+			}
+			if !notNull {
+				problems = append(problems, fmt.Sprintf("field %s: %s cannot hold NULL from nullable column %q", field.Name, field.Type, fd.Name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not match the result: %s", dest, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ClusterConfig configures NewCluster
+type ClusterConfig struct {
+	Primary       string        // connection string of the primary
+	Replicas      []string      // connection strings of the streaming replicas
+	MaxLag        time.Duration // replicas lagging further behind are not used, default 10s
+	CheckInterval time.Duration // time between replica lag checks, default 5s
+}
+
+// ReplicaStatus is the last observed state of a replica
+type ReplicaStatus struct {
+	Host    string
+	Healthy bool
+	Lag     time.Duration
+	Err     error // error of the last check, if any
+}
+
+// Cluster routes statements between a primary and its read replicas.
+// Query and QueryRow go to a healthy replica unless the context was marked with Primary;
+// Exec, transactions, CopyFrom and SendBatch always go to the primary. When no replica is
+// healthy, reads fall back to the primary.
+//
+// Use SetDefault to route the package-level functions through a Cluster.
+type Cluster struct {
+	primary  *pgxpool.Pool
+	writer   Querier // primary, replaced by a fake in tests
+	replicas []*replica
+	metrics  *metrics
+	maxLag   time.Duration
+	next     atomic.Uint32
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+var _ Querier = (*Cluster)(nil)
+
+type replica struct {
+	pool   *pgxpool.Pool
+	reader Querier // pool, replaced by a fake in tests
+
+	mu     sync.Mutex
+	status ReplicaStatus
+}
+
+type primaryKey struct{}
+
+// Primary returns a context that makes a Cluster send reads to the primary,
+// e.g. to read back a row that was just written
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func isPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// NewCluster connects to the primary and the replicas and starts checking replica lag
+func NewCluster(ctx context.Context, cfg ClusterConfig, opts ...Option) (*Cluster, error) {
+	if cfg.MaxLag <= 0 {
+		cfg.MaxLag = 10 * time.Second
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 5 * time.Second
+	}
+
+	c := &Cluster{metrics: newMetrics(), maxLag: cfg.MaxLag}
+	var err error
+	c.primary, err = c.newPool(ctx, cfg.Primary, opts)
+	if err != nil {
+		return nil, fmt.Errorf("dbx: primary: %w", err)
+	}
+	c.writer = c.primary
+	for i, connString := range cfg.Replicas {
+		pool, err := c.newPool(ctx, connString, opts)
+		if err != nil {
+			c.closePools()
+			return nil, fmt.Errorf("dbx: replica %d: %w", i, err)
+		}
+		r := &replica{pool: pool, reader: pool}
+		r.status.Host = pool.Config().ConnConfig.Host
+		c.replicas = append(c.replicas, r)
+	}
+
+	c.checkReplicas(ctx)
+	checkCtx, cancel := context.WithCancel(context.Background())
+	c.cancel, c.done = cancel, make(chan struct{})
+	go c.checkLoop(checkCtx, cfg.CheckInterval)
+	return c, nil
+}
+
+func (c *Cluster) newPool(ctx context.Context, connString string, opts []Option) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig = applyOptions(config.ConnConfig, c.metrics, opts)
+	return pgxpool.NewWithConfig(ctx, config)
+}
+
+// Close stops the lag checks and closes all pools
+func (c *Cluster) Close() {
+	c.cancel()
+	<-c.done
+	c.closePools()
+}
+
+func (c *Cluster) closePools() {
+	if c.primary != nil {
+		c.primary.Close()
+	}
+	for _, r := range c.replicas {
+		r.pool.Close()
+	}
+}
+
+// PrimaryPool returns the pool of the primary
+func (c *Cluster) PrimaryPool() *pgxpool.Pool {
+	return c.primary
+}
+
+// Replicas returns the last observed state of every replica
+func (c *Cluster) Replicas() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(c.replicas))
+	for i, r := range c.replicas {
+		r.mu.Lock()
+		statuses[i] = r.status
+		r.mu.Unlock()
+	}
+	return statuses
+}
+
+// reader returns where to send a read to, and the replica if it is not the primary
+func (c *Cluster) reader(ctx context.Context) (Querier, *replica) {
+	if isPrimary(ctx) || len(c.replicas) == 0 {
+		return c.writer, nil
+	}
+	start := c.next.Add(1)
+	for i := range c.replicas {
+		r := c.replicas[(int(start)+i)%len(c.replicas)]
+		r.mu.Lock()
+		healthy := r.status.Healthy
+		r.mu.Unlock()
+		if healthy {
+			return r.reader, r
+		}
+	}
+	return c.writer, nil
+}
+
+// Query sends the query to a replica. If the replica cannot be reached it is marked unhealthy and the query is retried on the primary.
+func (c *Cluster) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	q, r := c.reader(ctx)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil && r != nil && isConnError(err) {
+		r.markUnhealthy(err)
+		return c.writer.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+// QueryRow sends the query to a replica. If the replica cannot be reached it is marked unhealthy and the query is retried on the primary
+// when the row is scanned.
+func (c *Cluster) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	q, r := c.reader(ctx)
+	row := q.QueryRow(ctx, sql, args...)
+	if r == nil {
+		return row
+	}
+	return &failoverRow{Row: row, retry: func(err error) Row {
+		r.markUnhealthy(err)
+		return c.writer.QueryRow(ctx, sql, args...)
+	}}
+}
+
+// failoverRow is a row read from a replica, which is read again from the primary on a connection error
+type failoverRow struct {
+	Row
+	retry func(err error) Row
+}
+
+func (r *failoverRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	if err != nil && isConnError(err) {
+		return r.retry(err).Scan(dest...)
+	}
+	return err
+}
+
+// Exec sends the statement to the primary
+func (c *Cluster) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
+	return c.writer.Exec(ctx, sql, args...)
+}
+
+// Begin starts a transaction on the primary
+func (c *Cluster) Begin(ctx context.Context) (Tx, error) {
+	return c.primary.Begin(ctx)
+}
+
+// BeginTx starts a transaction with options on the primary
+func (c *Cluster) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (Tx, error) {
+	return c.primary.BeginTx(ctx, txOptions)
+}
+
+// CopyFrom copies rows into a table on the primary
+func (c *Cluster) CopyFrom(ctx context.Context, tableName Identifier, columnNames []string, rowSrc CopyFromSource) (int64, error) {
+	return c.primary.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// SendBatch sends a batch to the primary
+func (c *Cluster) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	return c.primary.SendBatch(ctx, b)
+}
+
+// Stats returns the metrics of all pools of the cluster combined
+func (c *Cluster) Stats() DBStats {
+	var stats DBStats
+	c.metrics.snapshot(&stats)
+	pools := []*pgxpool.Pool{c.primary}
+	for _, r := range c.replicas {
+		pools = append(pools, r.pool)
+	}
+	for _, p := range pools {
+		s := p.Stat()
+		stats.OpenConns += s.TotalConns()
+		stats.IdleConns += s.IdleConns()
+		stats.AcquiredConns += s.AcquiredConns()
+	}
+	return stats
+}
+
+func (c *Cluster) checkLoop(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkReplicas(ctx)
+		}
+	}
+}
+
+// replicaLagSQL reports zero lag when the replica is streaming and has replayed everything it received,
+// so that an idle primary does not make its replicas look stale. Without an active WAL receiver the lag is
+// the age of the last replayed transaction, or NULL if there is none. pg_stat_wal_receiver hides the status
+// from roles without pg_read_all_stats, but still has a row while a receiver runs.
+const replicaLagSQL = `SELECT pg_is_in_recovery(),
+	CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+		AND EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming') THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8 END`
+
+func (c *Cluster) checkReplicas(ctx context.Context) {
+	for _, r := range c.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		var inRecovery bool
+		var lag *float64
+		err := r.pool.QueryRow(checkCtx, replicaLagSQL).Scan(&inRecovery, &lag)
+		cancel()
+
+		r.mu.Lock()
+		r.status.Err = err
+		r.status.Lag = 0
+		if lag != nil {
+			r.status.Lag = time.Duration(*lag * float64(time.Second))
+		}
+		switch {
+		case err != nil:
+			r.status.Healthy = false
+		case !inRecovery:
+			r.status.Healthy = false
+			r.status.Err = errors.New("dbx: replica is not in recovery")
+		case lag == nil:
+			r.status.Healthy = false
+			r.status.Err = errors.New("dbx: replica is not streaming and has replayed no transaction")
+		default:
+			r.status.Healthy = r.status.Lag <= c.maxLag
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *replica) markUnhealthy(err error) {
+	r.mu.Lock()
+	r.status.Healthy = false
+	r.status.Err = err
+	r.mu.Unlock()
+}
+
+// isConnError reports whether err means the server could not be reached, as opposed to the statement failing.
+// Client-side errors, such as a wrong number of arguments, are not connection errors: the primary would fail the same way.
+func isConnError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) ||
+		errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,150 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeQuerier answers every statement with err, or with its name if err is nil
+type fakeQuerier struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	q.calls++
+	if q.err != nil {
+		return nil, q.err
+	}
+	return nil, nil
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	q.calls++
+	return fakeRow{q.name, q.err}
+}
+
+func (q *fakeQuerier) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
+	q.calls++
+	return pgconn.NewCommandTag("UPDATE 1"), q.err
+}
+
+type fakeRow struct {
+	name string
+	err  error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*string) = r.name
+	return nil
+}
+
+func testCluster(replicas ...*fakeQuerier) (*Cluster, *fakeQuerier) {
+	primary := &fakeQuerier{name: "primary"}
+	c := &Cluster{writer: primary}
+	for _, q := range replicas {
+		c.replicas = append(c.replicas, &replica{reader: q, status: ReplicaStatus{Host: q.name, Healthy: true}})
+	}
+	return c, primary
+}
+
+func readFrom(t *testing.T, ctx context.Context, c *Cluster) string {
+	t.Helper()
+	var name string
+	if err := c.QueryRow(ctx, "SELECT 1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestClusterRouting(t *testing.T) {
+	ctx := context.Background()
+	r1, r2 := &fakeQuerier{name: "r1"}, &fakeQuerier{name: "r2"}
+	c, primary := testCluster(r1, r2)
+
+	seen := map[string]int{}
+	for range 4 {
+		seen[readFrom(t, ctx, c)]++
+	}
+	if seen["r1"] != 2 || seen["r2"] != 2 {
+		t.Errorf("reads = %v, want 2 on each replica", seen)
+	}
+	if _, err := c.Query(ctx, "SELECT 1"); err != nil || r1.calls+r2.calls != 5 {
+		t.Errorf("Query: err %v, %d replica calls, want 5", err, r1.calls+r2.calls)
+	}
+
+	if got := readFrom(t, Primary(ctx), c); got != "primary" {
+		t.Errorf("read with Primary went to %s", got)
+	}
+	if _, err := c.Exec(ctx, "UPDATE t SET a = 1"); err != nil || primary.calls != 2 {
+		t.Errorf("Exec: err %v, %d primary calls, want 2", err, primary.calls)
+	}
+
+	c.replicas[0].markUnhealthy(errors.New("lagging"))
+	for range 2 {
+		if got := readFrom(t, ctx, c); got != "r2" {
+			t.Errorf("read went to %s with r1 unhealthy, want r2", got)
+		}
+	}
+	c.replicas[1].markUnhealthy(errors.New("lagging"))
+	if got := readFrom(t, ctx, c); got != "primary" {
+		t.Errorf("read went to %s with no healthy replica, want primary", got)
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	ctx := context.Background()
+	connErr := &pgconn.ConnectError{}
+	tests := []struct {
+		name         string
+		err          error
+		wantFailover bool
+	}{
+		{"connect error", connErr, true},
+		{"connection closed", io.ErrUnexpectedEOF, true},
+		{"statement error", &pgconn.PgError{Code: "42P01"}, false},
+		{"no rows", pgx.ErrNoRows, false},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, read := range []string{"Query", "QueryRow"} {
+				r := &fakeQuerier{name: "r", err: tt.err}
+				c, primary := testCluster(r)
+
+				var err error
+				if read == "Query" {
+					_, err = c.Query(ctx, "SELECT 1")
+				} else {
+					var name string
+					err = c.QueryRow(ctx, "SELECT 1").Scan(&name)
+				}
+
+				if tt.wantFailover {
+					if err != nil || primary.calls != 1 {
+						t.Errorf("%s: err %v, %d primary calls, want a retry on the primary", read, err, primary.calls)
+					}
+					if s := c.Replicas()[0]; s.Healthy || !errors.Is(s.Err, tt.err) {
+						t.Errorf("%s: replica status %+v, want unhealthy with %v", read, s, tt.err)
+					}
+					continue
+				}
+				if !errors.Is(err, tt.err) || primary.calls != 0 {
+					t.Errorf("%s: err %v, %d primary calls, want %v from the replica", read, err, primary.calls, tt.err)
+				}
+				if !c.Replicas()[0].Healthy {
+					t.Errorf("%s: replica marked unhealthy by %v", read, tt.err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Command dbxgen generates Go code for dbx from a database schema.
+//
+// Generate structs for the tables of a schema, read from a database or from a dump:
+//
+//	dbxgen [-db url | -from schema.json] [-schema public] [-tables a,b] [-pkg models] [-o models.go]
+//
+// Write a schema dump, e.g. to generate code without a database:
+//
+//	dbxgen dump [-db url] [-schema public] [-o schema.json]
+//
+// Generate typed functions from annotated queries, described by the database with Prepare:
+//
+//	dbxgen queries [-db url] [-pkg queries] [-o queries.go] queries/*.sql
+//
+// Each query in a .sql file follows an annotation naming the function and what it returns:
+// a slice of rows (dbx.Select), a single row (dbx.Get) or the command tag (dbx.Exec).
+//
+//	-- name: ListHoldings :many
+//	SELECT * FROM holdings WHERE loc = $1;
+//
+//	-- name: GetHolding :one
+//	-- name: DeleteHoldings :exec
+//
+// Without -db the connection is configured from DATABASE_URL or the PG* environment variables.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/schema"
+)
+
+// Dump is the schema dump written by "dbxgen dump" and read with -from
+type Dump struct {
+	Schema string
+	Tables []*schema.Table
+	Enums  []schema.Enum
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dbxgen: ")
+
+	args := os.Args[1:]
+	cmd := "structs"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "structs":
+		err = runStructs(args)
+	case "dump":
+		err = runDump(args)
+	case "queries":
+		err = runQueries(args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runStructs(args []string) error {
+	flags := flag.NewFlagSet("dbxgen", flag.ExitOnError)
+	dbURL := flags.String("db", "", "connection string")
+	from := flags.String("from", "", "read the schema from a dump instead of a database")
+	schemaName := flags.String("schema", "public", "schema to read")
+	tables := flags.String("tables", "", "comma-separated tables to generate, all if empty")
+	pkg := flags.String("pkg", "models", "package name")
+	out := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+
+	dump, err := loadDump(context.Background(), *dbURL, *from, *schemaName)
+	if err != nil {
+		return err
+	}
+	var only []string
+	if *tables != "" {
+		only = strings.Split(*tables, ",")
+	}
+	src, err := generateStructs(dump, *pkg, only)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, src)
+}
+
+func runDump(args []string) error {
+	flags := flag.NewFlagSet("dbxgen dump", flag.ExitOnError)
+	dbURL := flags.String("db", "", "connection string")
+	schemaName := flags.String("schema", "public", "schema to read")
+	out := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+
+	dump, err := loadDump(context.Background(), *dbURL, "", *schemaName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, append(data, '\n'))
+}
+
+// loadDump reads the dump in file from, or the tables and enums of schemaName from the database
+func loadDump(ctx context.Context, dbURL, from, schemaName string) (*Dump, error) {
+	if from != "" {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return nil, err
+		}
+		dump := &Dump{}
+		if err := json.Unmarshal(data, dump); err != nil {
+			return nil, fmt.Errorf("%s: %w", from, err)
+		}
+		return dump, nil
+	}
+
+	if err := dbx.Connect(ctx, dbURL); err != nil {
+		return nil, err
+	}
+	defer dbx.Close(ctx)
+
+	dump := &Dump{Schema: schemaName}
+	var err error
+	if dump.Tables, err = schema.Tables(ctx, dbx.Conn(), schemaName); err != nil {
+		return nil, err
+	}
+	if dump.Enums, err = schema.Enums(ctx, dbx.Conn(), schemaName); err != nil {
+		return nil, err
+	}
+	return dump, nil
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
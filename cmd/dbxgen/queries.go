@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/schema"
+)
+
+// query is an annotated statement read from a .sql file
+type query struct {
+	name string // Go function name
+	kind string // ":many", ":one" or ":exec"
+	sql  string
+	pos  string // file:line of the annotation
+}
+
+// param is a generated function parameter
+type param struct {
+	name   string
+	goType string
+}
+
+// field is a generated result struct field
+type field struct {
+	column string
+	goType string
+}
+
+var annotation = regexp.MustCompile(`^--\s*name:\s*(\w+)\s+(:many|:one|:exec)\s*$`)
+
+func runQueries(args []string) error {
+	flags := flag.NewFlagSet("dbxgen queries", flag.ExitOnError)
+	dbURL := flags.String("db", "", "connection string")
+	pkg := flags.String("pkg", "queries", "package name")
+	out := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: dbxgen queries [-db url] [-pkg name] [-o file] file.sql...")
+	}
+
+	var queries []query
+	for _, pattern := range flags.Args() {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%s: no such file", pattern)
+		}
+		for _, file := range files {
+			qs, err := parseQueries(file)
+			if err != nil {
+				return err
+			}
+			queries = append(queries, qs...)
+		}
+	}
+
+	ctx := context.Background()
+	if err := dbx.Connect(ctx, *dbURL); err != nil {
+		return err
+	}
+	defer dbx.Close(ctx)
+
+	g := newGenerator()
+	g.imports["context"] = true
+	g.imports["github.com/xtdlib/dbx"] = true
+	for _, q := range queries {
+		if err := g.query(ctx, q); err != nil {
+			return fmt.Errorf("%s: %s: %w", q.pos, q.name, err)
+		}
+	}
+	src, err := g.source(*pkg)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, src)
+}
+
+// parseQueries splits file into the statements following "-- name: Name :kind" annotations
+func parseQueries(file string) ([]query, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var queries []query
+	var body strings.Builder
+	flush := func() {
+		if len(queries) > 0 {
+			sql := strings.TrimSpace(body.String())
+			queries[len(queries)-1].sql = strings.TrimSpace(strings.TrimSuffix(sql, ";"))
+		}
+		body.Reset()
+	}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if m := annotation.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+			flush()
+			queries = append(queries, query{name: m[1], kind: m[2], pos: fmt.Sprintf("%s:%d", file, line)})
+			continue
+		}
+		body.WriteString(text)
+		body.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	for _, q := range queries {
+		if q.sql == "" {
+			return nil, fmt.Errorf("%s: %s: empty query", q.pos, q.name)
+		}
+	}
+	return queries, nil
+}
+
+// query describes q on the server and generates its function and result struct
+func (g *generator) query(ctx context.Context, q query) error {
+	stmt := "dbxgen_" + q.name
+	desc, err := dbx.Prepare(ctx, stmt, q.sql)
+	if err != nil {
+		return err
+	}
+	defer dbx.Deallocate(ctx, stmt)
+
+	params, err := g.params(ctx, q.sql, desc.ParamOIDs)
+	if err != nil {
+		return err
+	}
+	var fields []field
+	if q.kind != ":exec" {
+		if len(desc.Fields) == 0 {
+			return fmt.Errorf("%s query returns no columns", q.kind)
+		}
+		if fields, err = g.fields(ctx, desc.Fields); err != nil {
+			return err
+		}
+	}
+
+	sqlConst := strings.ToLower(q.name[:1]) + q.name[1:] + "SQL"
+	g.printf("const %s = %s\n\n", sqlConst, quoteSQL(q.sql))
+
+	rowType := q.name + "Row"
+	if q.kind != ":exec" {
+		g.printf("// %s is a row returned by %s\n", rowType, q.name)
+		g.printf("type %s struct {\n", rowType)
+		for _, f := range fields {
+			g.printf("\t%s %s `db:%q`\n", goName(f.column), f.goType, f.column)
+		}
+		g.printf("}\n\n")
+	}
+
+	var decl, call []string
+	for _, p := range params {
+		decl = append(decl, p.name+" "+p.goType)
+		call = append(call, p.name)
+	}
+	args := strings.Join(append([]string{sqlConst}, call...), ", ")
+	g.printf("// %s runs the %s query\n", q.name, q.name)
+	g.printf("func %s(%s) ", q.name, strings.Join(append([]string{"ctx context.Context"}, decl...), ", "))
+	switch q.kind {
+	case ":many":
+		g.printf("([]*%s, error) {\n\treturn dbx.Select[%s](ctx, %s)\n}\n\n", rowType, rowType, args)
+	case ":one":
+		g.printf("(*%s, error) {\n\treturn dbx.Get[%s](ctx, %s)\n}\n\n", rowType, rowType, args)
+	case ":exec":
+		g.printf("(dbx.CommandTag, error) {\n\treturn dbx.Exec(ctx, %s)\n}\n\n", args)
+	}
+	return nil
+}
+
+// paramName matches a column compared with a parameter, e.g. "loc = $1", to name the parameter
+var paramName = regexp.MustCompile(`(?i)(\w+)\s*(?:=|<>|!=|<=|>=|<|>|\s+like|\s+ilike)\s*\$(\d+)\b`)
+
+// params returns the function parameters for a statement with parameter types oids
+func (g *generator) params(ctx context.Context, sql string, oids []uint32) ([]param, error) {
+	names := make(map[string]string)
+	for _, m := range paramName.FindAllStringSubmatch(sql, -1) {
+		if _, ok := names[m[2]]; !ok {
+			names[m[2]] = m[1]
+		}
+	}
+
+	used := map[string]bool{"ctx": true}
+	params := make([]param, len(oids))
+	for i, oid := range oids {
+		col, err := typeColumn(ctx, oid)
+		if err != nil {
+			return nil, err
+		}
+		col.NotNull = true
+
+		name := fmt.Sprintf("arg%d", i+1)
+		if column, ok := names[fmt.Sprint(i+1)]; ok {
+			if n := paramGoName(column); !used[n] {
+				name = n
+			}
+		}
+		used[name] = true
+		params[i] = param{name: name, goType: g.columnType(col)}
+	}
+	return params, nil
+}
+
+// fields returns the result struct fields. Columns read directly from a table are nullable
+// if the table column is; computed columns are always treated as nullable.
+func (g *generator) fields(ctx context.Context, descs []pgconn.FieldDescription) ([]field, error) {
+	if err := checkColumns(descs); err != nil {
+		return nil, err
+	}
+	fields := make([]field, len(descs))
+	for i, fd := range descs {
+		col, err := typeColumn(ctx, fd.DataTypeOID)
+		if err != nil {
+			return nil, err
+		}
+		if fd.TableOID != 0 {
+			err := dbx.QueryRow(ctx, "SELECT attnotnull FROM pg_attribute WHERE attrelid = $1 AND attnum = $2",
+				fd.TableOID, fd.TableAttributeNumber).Scan(&col.NotNull)
+			if err != nil {
+				return nil, err
+			}
+		}
+		fields[i] = field{column: fd.Name, goType: g.columnType(col)}
+	}
+	return fields, nil
+}
+
+// checkColumns returns an error if two result columns would become the same struct field,
+// e.g. the id columns of a join
+func checkColumns(descs []pgconn.FieldDescription) error {
+	columns := make(map[string]string)
+	for _, fd := range descs {
+		name := goName(fd.Name)
+		switch column, ok := columns[name]; {
+		case ok && column == fd.Name:
+			return fmt.Errorf("column %q is returned twice; alias one of them, e.g. %s AS other_%s", fd.Name, fd.Name, fd.Name)
+		case ok:
+			return fmt.Errorf("columns %q and %q are both named %s in Go; alias one of them", column, fd.Name, name)
+		}
+		columns[name] = fd.Name
+	}
+	return nil
+}
+
+// typeColumn returns a column of the type with oid. Enums are mapped to text, so they are generated as strings.
+func typeColumn(ctx context.Context, oid uint32) (schema.Column, error) {
+	col := schema.Column{TypeOID: oid}
+	var typtype string
+	err := dbx.QueryRow(ctx, "SELECT typname, typtype::text, typcategory = 'A' FROM pg_type WHERE oid = $1", oid).
+		Scan(&col.TypeName, &typtype, &col.IsArray)
+	if typtype == "e" {
+		col.TypeName = "text"
+	}
+	return col, err
+}
+
+// paramGoName turns a column name into an unexported Go name, e.g. "user_id" into "userID"
+func paramGoName(column string) string {
+	name := goName(column)
+	upper := 0
+	for upper < len(name) && name[upper] >= 'A' && name[upper] <= 'Z' {
+		upper++
+	}
+	// lower the leading initialism or the first letter: "IDs" -> "ids", "UserID" -> "userID"
+	if upper > 1 && upper < len(name) {
+		upper--
+	}
+	name = strings.ToLower(name[:max(upper, 1)]) + name[max(upper, 1):]
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+// quoteSQL returns sql as a raw string literal if possible
+func quoteSQL(sql string) string {
+	if strings.Contains(sql, "`") {
+		return fmt.Sprintf("%q", sql)
+	}
+	return "`" + sql + "`"
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestParseQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []query
+		wantErr string
+	}{
+		{
+			name: "annotated queries",
+			src: `-- a file comment
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE org = $1;
+
+  --  name:GetUser   :one
+SELECT * FROM users WHERE id = $1;
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`,
+			want: []query{
+				{name: "ListUsers", kind: ":many", sql: "SELECT * FROM users\nWHERE org = $1", pos: "queries.sql:2"},
+				{name: "GetUser", kind: ":one", sql: "SELECT * FROM users WHERE id = $1", pos: "queries.sql:6"},
+				{name: "DeleteUser", kind: ":exec", sql: "DELETE FROM users WHERE id = $1", pos: "queries.sql:8"},
+			},
+		},
+		{
+			name: "not annotations",
+			src: `-- name: Count :one
+SELECT count(*) FROM users -- name: Other :one
+-- name: Bad :all
+`,
+			want: []query{
+				{name: "Count", kind: ":one", sql: "SELECT count(*) FROM users -- name: Other :one\n-- name: Bad :all", pos: "queries.sql:1"},
+			},
+		},
+		{
+			name: "no annotations",
+			src:  "SELECT 1;\n",
+		},
+		{
+			name:    "empty query",
+			src:     "-- name: A :one\nSELECT 1;\n-- name: B :exec\n;\n",
+			wantErr: "queries.sql:3: B: empty query",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "queries.sql"), []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(dir)
+
+			got, err := parseQueries("queries.sql")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseQueries(filepath.Join(t.TempDir(), "missing.sql")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+func TestParamGoName(t *testing.T) {
+	tests := map[string]string{
+		"loc":        "loc",
+		"user_id":    "userID",
+		"id":         "id",
+		"ids":        "ids",
+		"url_path":   "urlPath",
+		"created_at": "createdAt",
+		"type":       "type_",
+		"func":       "func_",
+		"2fa_code":   "x2faCode",
+		"UserName":   "userName",
+	}
+	for column, want := range tests {
+		if got := paramGoName(column); got != want {
+			t.Errorf("paramGoName(%q) = %q, want %q", column, got, want)
+		}
+	}
+}
+
+func TestQuoteSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT 1", "`SELECT 1`"},
+		{"SELECT *\nFROM \"users\"\nWHERE name = 'a\\b'", "`SELECT *\nFROM \"users\"\nWHERE name = 'a\\b'`"},
+		{"SELECT `x`", "\"SELECT `x`\""},
+		{"SELECT `x`\nFROM \"t\"", "\"SELECT `x`\\nFROM \\\"t\\\"\""},
+	}
+	for _, tt := range tests {
+		if got := quoteSQL(tt.sql); got != tt.want {
+			t.Errorf("quoteSQL(%q) = %s, want %s", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	fields := func(names ...string) []pgconn.FieldDescription {
+		var descs []pgconn.FieldDescription
+		for _, n := range names {
+			descs = append(descs, pgconn.FieldDescription{Name: n})
+		}
+		return descs
+	}
+	tests := []struct {
+		columns []string
+		wantErr string
+	}{
+		{[]string{"id", "user_id", "name"}, ""},
+		{[]string{"id", "name", "id"}, `column "id" is returned twice`},
+		{[]string{"user_id", "userID"}, `columns "user_id" and "userID" are both named UserID`},
+	}
+	for _, tt := range tests {
+		err := checkColumns(fields(tt.columns...))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%v: %v", tt.columns, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%v: err = %v, want %q", tt.columns, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/xtdlib/dbx/schema"
+)
+
+// goType is the Go type generated for a column type
+type goType struct {
+	name     string
+	pkg      string // import path needed by name
+	nullable bool   // the type can hold NULL without a pointer
+}
+
+// builtinTypes maps pg_type names to Go types scannable by dbx
+var builtinTypes = map[string]goType{
+	"bool":        {name: "bool"},
+	"int2":        {name: "int16"},
+	"int4":        {name: "int32"},
+	"int8":        {name: "int64"},
+	"oid":         {name: "uint32"},
+	"float4":      {name: "float32"},
+	"float8":      {name: "float64"},
+	"numeric":     {name: "pgtype.Numeric", pkg: "github.com/jackc/pgx/v5/pgtype", nullable: true},
+	"text":        {name: "string"},
+	"varchar":     {name: "string"},
+	"bpchar":      {name: "string"},
+	"char":        {name: "string"},
+	"name":        {name: "string"},
+	"citext":      {name: "string"},
+	"xml":         {name: "string"},
+	"inet":        {name: "string"},
+	"cidr":        {name: "string"},
+	"macaddr":     {name: "string"},
+	"uuid":        {name: "pgtype.UUID", pkg: "github.com/jackc/pgx/v5/pgtype", nullable: true},
+	"json":        {name: "[]byte", nullable: true},
+	"jsonb":       {name: "[]byte", nullable: true},
+	"bytea":       {name: "[]byte", nullable: true},
+	"date":        {name: "time.Time", pkg: "time"},
+	"timestamp":   {name: "time.Time", pkg: "time"},
+	"timestamptz": {name: "time.Time", pkg: "time"},
+	"time":        {name: "pgtype.Time", pkg: "github.com/jackc/pgx/v5/pgtype", nullable: true},
+	"interval":    {name: "pgtype.Interval", pkg: "github.com/jackc/pgx/v5/pgtype", nullable: true},
+}
+
+// generator accumulates generated code and the imports it needs
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+	enums   map[string]string // pg_type name to Go type name
+}
+
+func newGenerator() *generator {
+	return &generator{imports: make(map[string]bool), enums: make(map[string]string)}
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// source returns the formatted file with a header for package pkg
+func (g *generator) source(pkg string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by dbxgen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for p := range g.imports {
+			paths = append(paths, p)
+		}
+		// standard library first, then a blank line and the rest
+		sort.Slice(paths, func(i, j int) bool {
+			if std(paths[i]) != std(paths[j]) {
+				return std(paths[i])
+			}
+			return paths[i] < paths[j]
+		})
+		out.WriteString("import (\n")
+		for i, p := range paths {
+			if i > 0 && std(p) != std(paths[i-1]) {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "\t%q\n", p)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// std reports whether the import path belongs to the standard library
+func std(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// baseType returns the Go type for the pg_type typeName
+func (g *generator) baseType(typeName string) goType {
+	if name, ok := g.enums[typeName]; ok {
+		return goType{name: name}
+	}
+	if t, ok := builtinTypes[typeName]; ok {
+		return t
+	}
+	return goType{name: "any", nullable: true}
+}
+
+// columnType returns the Go type for col: arrays become slices and nullable columns pointers,
+// unless the type can hold NULL itself
+func (g *generator) columnType(col schema.Column) string {
+	elem, isArray := strings.CutPrefix(col.TypeName, "_")
+	if col.IsArray && isArray {
+		t := g.baseType(elem)
+		g.use(t)
+		return "[]" + t.name
+	}
+	t := g.baseType(col.TypeName)
+	g.use(t)
+	if !col.NotNull && !t.nullable {
+		return "*" + t.name
+	}
+	return t.name
+}
+
+func (g *generator) use(t goType) {
+	if t.pkg != "" {
+		g.imports[t.pkg] = true
+	}
+}
+
+// enum generates a string type with a constant per value
+func (g *generator) enum(e schema.Enum) {
+	name := g.enums[e.Name]
+	g.printf("// %s is the %s enum type\n", name, e.Name)
+	g.printf("type %s string\n\n", name)
+	if len(e.Values) == 0 {
+		return
+	}
+	g.printf("const (\n")
+	for _, v := range e.Values {
+		g.printf("\t%s %s = %q\n", name+goName(v), name, v)
+	}
+	g.printf(")\n\n")
+}
+
+// table generates a struct with a field per column
+func (g *generator) table(t *schema.Table) {
+	var pk []string
+	if t.PrimaryKey != nil {
+		pk = t.PrimaryKey.Columns
+	}
+
+	g.printf("// %s is a row of the %s table\n", goName(t.Name), t.Name)
+	g.printf("type %s struct {\n", goName(t.Name))
+	for _, col := range t.Columns {
+		tag := col.Name
+		switch {
+		case slices.Contains(pk, col.Name):
+			tag += ",pk"
+		case col.Generated || col.Identity == "always":
+			tag += ",readonly"
+		}
+		g.printf("\t%s %s `db:%q`\n", goName(col.Name), g.columnType(col), tag)
+	}
+	g.printf("}\n\n")
+}
+
+// generateStructs generates enum types and table structs from dump, restricted to the tables in only if it is not empty
+func generateStructs(dump *Dump, pkg string, only []string) ([]byte, error) {
+	tables := dump.Tables
+	if len(only) > 0 {
+		tables = nil
+		for _, name := range only {
+			i := slices.IndexFunc(dump.Tables, func(t *schema.Table) bool { return t.Name == name })
+			if i < 0 {
+				return nil, fmt.Errorf("table %q not found in schema %s", name, dump.Schema)
+			}
+			tables = append(tables, dump.Tables[i])
+		}
+	}
+
+	g := newGenerator()
+	for _, e := range dump.Enums {
+		g.enums[e.Name] = goName(e.Name)
+	}
+	for _, e := range dump.Enums {
+		g.enum(e)
+	}
+	for _, t := range tables {
+		g.table(t)
+	}
+	return g.source(pkg)
+}
@@ -0,0 +1,221 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNoConfig is returned by ResolveConfig when no connection settings were found
+var ErrNoConfig = errors.New("dbx: no database configured: set DATABASE_URL, PG* variables or PGSERVICE")
+
+// ResolvedConfig is a connection config together with where it came from
+type ResolvedConfig struct {
+	*pgx.ConnConfig
+	Source string // "argument", "DATABASE_URL", "DATABASE_URL_FILE" or "PG environment"
+}
+
+// String returns the config as a URL with the password redacted, suitable for logging
+func (c *ResolvedConfig) String() string {
+	u := url.URL{Scheme: "postgres", Path: "/" + c.Database}
+	q := url.Values{}
+	if hosts, sockets := c.hosts(); sockets {
+		q.Set("host", strings.Join(hosts, ","))
+		q.Set("port", strconv.Itoa(int(c.Port)))
+	} else {
+		u.Host = strings.Join(hosts, ",")
+	}
+	switch {
+	case c.User != "" && c.Password != "":
+		u.User = url.UserPassword(c.User, "xxxxx")
+	case c.User != "":
+		u.User = url.User(c.User)
+	}
+	if c.TLSConfig == nil {
+		q.Set("sslmode", "disable")
+	}
+	if name := c.RuntimeParams["application_name"]; name != "" {
+		q.Set("application_name", name)
+	}
+	u.RawQuery = q.Encode()
+	return u.String() + " (from " + c.Source + ")"
+}
+
+// hosts returns the host and the distinct fallback hosts, as host:port unless one of them is a Unix socket directory.
+// pgx also adds fallbacks that only differ in TLS, e.g. for sslmode=prefer, which are left out.
+func (c *ResolvedConfig) hosts() (hosts []string, sockets bool) {
+	type hostPort struct {
+		host string
+		port uint16
+	}
+	all := []hostPort{{c.Host, c.Port}}
+	for _, f := range c.Fallbacks {
+		if hp := (hostPort{f.Host, f.Port}); !slices.Contains(all, hp) {
+			all = append(all, hp)
+		}
+	}
+	for _, hp := range all {
+		sockets = sockets || strings.HasPrefix(hp.host, "/")
+	}
+	for _, hp := range all {
+		if sockets {
+			hosts = append(hosts, hp.host)
+		} else {
+			hosts = append(hosts, net.JoinHostPort(hp.host, strconv.Itoa(int(hp.port))))
+		}
+	}
+	return hosts, sockets
+}
+
+// envSettings maps libpq environment variables to connection string keywords
+var envSettings = []struct{ env, key string }{
+	{"PGHOST", "host"},
+	{"PGPORT", "port"},
+	{"PGDATABASE", "dbname"},
+	{"PGUSER", "user"},
+	{"PGPASSWORD", "password"},
+	{"PGPASSFILE", "passfile"},
+	{"PGAPPNAME", "application_name"},
+	{"PGCONNECT_TIMEOUT", "connect_timeout"},
+	{"PGSSLMODE", "sslmode"},
+	{"PGSSLCERT", "sslcert"},
+	{"PGSSLKEY", "sslkey"},
+	{"PGSSLROOTCERT", "sslrootcert"},
+	{"PGSSLPASSWORD", "sslpassword"},
+	{"PGTARGETSESSIONATTRS", "target_session_attrs"},
+	{"PGSERVICE", "service"},
+	{"PGSERVICEFILE", "servicefile"},
+}
+
+// pgEnv are the variables pgx applies to settings a connection string leaves out
+var pgEnv = []string{
+	"PGHOST", "PGPORT", "PGDATABASE", "PGUSER", "PGPASSWORD", "PGPASSFILE", "PGAPPNAME", "PGCONNECT_TIMEOUT",
+	"PGSSLMODE", "PGSSLKEY", "PGSSLCERT", "PGSSLSNI", "PGSSLROOTCERT", "PGSSLPASSWORD", "PGSSLNEGOTIATION",
+	"PGTARGETSESSIONATTRS", "PGSERVICE", "PGSERVICEFILE", "PGTZ", "PGOPTIONS",
+}
+
+// parseMu serializes parseWithoutEnv, which changes the environment
+var parseMu sync.Mutex
+
+// parseWithoutEnv parses connString with the PG* variables removed from the environment for the duration,
+// so that they do not fill in settings connString leaves out
+func parseWithoutEnv(connString string) (*pgx.ConnConfig, error) {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	saved := make(map[string]string)
+	for _, name := range pgEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			saved[name] = v
+			os.Unsetenv(name)
+		}
+	}
+	defer func() {
+		for name, v := range saved {
+			os.Setenv(name, v)
+		}
+	}()
+	return pgx.ParseConfig(connString)
+}
+
+// ResolveConfig builds a connection config. Sources are tried in this order and the first one set wins:
+//
+//  1. connString, if not empty
+//  2. DATABASE_URL, or the contents of the file named by DATABASE_URL_FILE
+//  3. the libpq PG* variables (PGHOST, PGPORT, PGDATABASE, PGUSER, PGPASSWORD, PGSSLMODE, ...)
+//     including a PGSERVICE entry from PGSERVICEFILE or ~/.pg_service.conf; explicit PG* variables
+//     override the service entry
+//
+// Every variable may instead be given as NAME_FILE holding the path of a file with the value,
+// as is common for Docker and Kubernetes secrets; setting both NAME and NAME_FILE is an error.
+// When the chosen source has no password, PGPASSWORD or PGPASSWORD_FILE is used. The other PG*
+// variables do not apply to connString or DATABASE_URL; settings they leave out get the pgx defaults.
+// To keep pgx from reading them, they are removed from the environment while connString or
+// DATABASE_URL is parsed, so call ResolveConfig before starting goroutines that read them.
+func ResolveConfig(connString string) (*ResolvedConfig, error) {
+	source := "argument"
+	if connString == "" {
+		var err error
+		source, connString, err = resolveEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var config *pgx.ConnConfig
+	var err error
+	if source == "PG environment" {
+		config, err = pgx.ParseConfig(connString)
+	} else {
+		config, err = parseWithoutEnv(connString)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dbx: invalid config from %s: %w", source, err)
+	}
+	if config.Password == "" {
+		password, err := lookupEnv("PGPASSWORD")
+		if err != nil {
+			return nil, err
+		}
+		config.Password = password
+	}
+	return &ResolvedConfig{ConnConfig: config, Source: source}, nil
+}
+
+// resolveEnv returns the connection string from the environment and its source
+func resolveEnv() (source, connString string, err error) {
+	dsn, err := lookupEnv("DATABASE_URL")
+	if err != nil {
+		return "", "", err
+	}
+	if dsn != "" {
+		source = "DATABASE_URL"
+		if os.Getenv("DATABASE_URL_FILE") != "" {
+			source = "DATABASE_URL_FILE"
+		}
+		return source, dsn, nil
+	}
+
+	var settings []string
+	for _, s := range envSettings {
+		v, err := lookupEnv(s.env)
+		if err != nil {
+			return "", "", err
+		}
+		if v != "" {
+			settings = append(settings, s.key+"="+quoteSetting(v))
+		}
+	}
+	if len(settings) == 0 {
+		return "", "", ErrNoConfig
+	}
+	return "PG environment", strings.Join(settings, " "), nil
+}
+
+// lookupEnv returns the value of the variable name or the contents of the file named by name_FILE
+func lookupEnv(name string) (string, error) {
+	value, file := os.Getenv(name), os.Getenv(name+"_FILE")
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("dbx: both %s and %s_FILE are set", name, name)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("dbx: %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// quoteSetting quotes a keyword/value connection string value
+func quoteSetting(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
@@ -0,0 +1,238 @@
+// Package dbxmock is a scripted fake of the dbx Querier for unit tests without a database.
+//
+//	mock := dbxmock.New(t)
+//	mock.ExpectQuery(`SELECT .* FROM holdings WHERE loc = \$1`).
+//		WithArgs("binance").
+//		WillReturnRows([]string{"loc", "currency", "notes"}, [][]any{{"binance", "btc", nil}})
+//
+//	holdings, err := dbx.Select[Holdings](mock.Context(ctx), "SELECT * FROM holdings WHERE loc = $1", "binance")
+//
+// Statements must arrive in the order they are expected. Statements that match no expectation
+// fail the test, and so do expectations still unmet when the test ends.
+package dbxmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+)
+
+// ErrUnexpected is returned for statements that match no expectation
+var ErrUnexpected = errors.New("dbxmock: unexpected statement")
+
+// Mock implements dbx.Querier with scripted expectations
+type Mock struct {
+	t  testing.TB
+	mu sync.Mutex
+
+	expected []*Expectation
+	next     int // index of the next expectation to meet
+}
+
+var _ dbx.Querier = (*Mock)(nil)
+
+// New returns a mock that fails t if expectations are unmet when the test ends
+func New(t testing.TB) *Mock {
+	m := &Mock{t: t}
+	t.Cleanup(func() {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return m
+}
+
+// Context returns a context that makes the package-level dbx functions use the mock
+func (m *Mock) Context(ctx context.Context) context.Context {
+	return dbx.WithQuerier(ctx, m)
+}
+
+// ExpectQuery expects Query or QueryRow with SQL matching the regular expression pattern
+func (m *Mock) ExpectQuery(pattern string) *Expectation {
+	return m.expect("query", pattern)
+}
+
+// ExpectExec expects Exec with SQL matching the regular expression pattern
+func (m *Mock) ExpectExec(pattern string) *Expectation {
+	return m.expect("exec", pattern)
+}
+
+func (m *Mock) expect(kind, pattern string) *Expectation {
+	e := &Expectation{kind: kind, pattern: regexp.MustCompile(pattern)}
+	m.mu.Lock()
+	m.expected = append(m.expected, e)
+	m.mu.Unlock()
+	return e
+}
+
+// ExpectationsWereMet returns an error listing the expectations that were not met
+func (m *Mock) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var unmet []string
+	for _, e := range m.expected[m.next:] {
+		unmet = append(unmet, e.String())
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("dbxmock: unmet expectations: %s", strings.Join(unmet, "; "))
+	}
+	return nil
+}
+
+// match meets the next expectation with the statement, or fails the test
+func (m *Mock) match(kind, sql string, args []any) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	if m.next >= len(m.expected) {
+		err = fmt.Errorf("%w: %s %q with args %v, all expectations were met", ErrUnexpected, kind, sql, args)
+	} else if e := m.expected[m.next]; !e.matches(kind, sql, args) {
+		err = fmt.Errorf("%w: %s %q with args %v, expected %s", ErrUnexpected, kind, sql, args, e)
+	} else {
+		m.next++
+		return e, nil
+	}
+	m.t.Error(err)
+	return nil, err
+}
+
+// Query meets an ExpectQuery expectation and returns its rows
+func (m *Mock) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	e, err := m.match("query", sql, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return newRows(e.columns, e.rows), nil
+}
+
+// QueryRow meets an ExpectQuery expectation and returns its first row
+func (m *Mock) QueryRow(ctx context.Context, sql string, args ...any) dbx.Row {
+	rows, err := m.Query(ctx, sql, args...)
+	return &row{rows: rows, err: err}
+}
+
+// Exec meets an ExpectExec expectation and returns its command tag
+func (m *Mock) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	e, err := m.match("exec", sql, args)
+	if err != nil {
+		return dbx.CommandTag{}, err
+	}
+	if e.err != nil {
+		return dbx.CommandTag{}, e.err
+	}
+	return pgconn.NewCommandTag(e.tag), nil
+}
+
+// Expectation is an expected statement and its scripted result
+type Expectation struct {
+	kind    string
+	pattern *regexp.Regexp
+	args    []any // nil matches any arguments
+
+	columns []string
+	rows    [][]any
+	tag     string
+	err     error
+}
+
+// Argument matches an argument in a custom way
+type Argument interface {
+	Match(v any) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(any) bool { return true }
+
+func (anyArg) String() string { return "<any>" }
+
+// AnyArg matches any argument
+func AnyArg() Argument {
+	return anyArg{}
+}
+
+// WithArgs expects exactly args. Values are compared with reflect.DeepEqual after converting
+// integers to int64, floats to float64 and typed nils to nil; Arguments match themselves.
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = append([]any{}, args...)
+	return e
+}
+
+// WillReturnRows makes the query return rows with columns. Values are assigned to the scan
+// destinations directly, through sql.Scanner (e.g. a string for pgtype.Numeric) or by conversion.
+func (e *Expectation) WillReturnRows(columns []string, rows [][]any) *Expectation {
+	e.columns, e.rows = columns, rows
+	return e
+}
+
+// WillReturnTag makes Exec return the command tag, e.g. "UPDATE 3"
+func (e *Expectation) WillReturnTag(tag string) *Expectation {
+	e.tag = tag
+	return e
+}
+
+// WillReturnError makes the statement fail with err
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) String() string {
+	if e.args == nil {
+		return fmt.Sprintf("%s matching %q", e.kind, e.pattern)
+	}
+	return fmt.Sprintf("%s matching %q with args %v", e.kind, e.pattern, e.args)
+}
+
+func (e *Expectation) matches(kind, sql string, args []any) bool {
+	if kind != e.kind || !e.pattern.MatchString(sql) {
+		return false
+	}
+	if e.args == nil {
+		return true
+	}
+	if len(args) != len(e.args) {
+		return false
+	}
+	for i, want := range e.args {
+		if a, ok := want.(Argument); ok {
+			if !a.Match(args[i]) {
+				return false
+			}
+		} else if !reflect.DeepEqual(normalize(want), normalize(args[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize converts integers to int64, floats to float64 and typed nils to nil,
+// so that 1 matches int64(1) and nil matches a nil *string
+func normalize(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
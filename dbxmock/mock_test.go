@@ -0,0 +1,321 @@
+package dbxmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx"
+)
+
+// fakeT records the errors a Mock reports instead of failing the test
+type fakeT struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeT) Error(args ...any) {
+	f.errors = append(f.errors, fmt.Sprint(args...))
+}
+
+func (f *fakeT) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// end runs the cleanups as the end of a test would
+func (f *fakeT) end() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+type holding struct {
+	Loc      string  `db:"loc"`
+	Currency string  `db:"currency"`
+	Amount   float64 `db:"amount"`
+	Notes    *string `db:"notes"`
+}
+
+func TestGet(t *testing.T) {
+	mock := New(t)
+	mock.ExpectQuery(`SELECT .* FROM holdings WHERE loc = \$1`).
+		WithArgs("binance").
+		WillReturnRows([]string{"loc", "currency", "amount", "notes", "extra"}, [][]any{{"binance", "btc", 1.5, "first", 7}})
+
+	h, err := dbx.Get[holding](mock.Context(context.Background()), "SELECT * FROM holdings WHERE loc = $1", "binance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Loc != "binance" || h.Currency != "btc" || h.Amount != 1.5 || h.Notes == nil || *h.Notes != "first" {
+		t.Errorf("got %+v", h)
+	}
+}
+
+func TestGetNoRows(t *testing.T) {
+	mock := New(t)
+	mock.ExpectQuery(`SELECT`).WillReturnRows([]string{"loc"}, nil)
+
+	_, err := dbx.Get[holding](mock.Context(context.Background()), "SELECT loc FROM holdings")
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("err = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	mock := New(t)
+	mock.ExpectQuery(`SELECT loc, currency, amount, notes FROM holdings`).
+		WillReturnRows([]string{"loc", "currency", "amount", "notes"}, [][]any{
+			{"binance", "btc", 1.5, nil},
+			{"kraken", "sol", int64(100), "staked"},
+		})
+
+	hs, err := dbx.Select[holding](mock.Context(context.Background()), "SELECT loc, currency, amount, notes FROM holdings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 2 {
+		t.Fatalf("got %d rows, want 2", len(hs))
+	}
+	if hs[0].Loc != "binance" || hs[0].Notes != nil {
+		t.Errorf("row 1 = %+v", hs[0])
+	}
+	if hs[1].Amount != 100 || hs[1].Notes == nil || *hs[1].Notes != "staked" {
+		t.Errorf("row 2 = %+v", hs[1])
+	}
+}
+
+func TestSelectError(t *testing.T) {
+	mock := New(t)
+	want := errors.New("boom")
+	mock.ExpectQuery(`SELECT`).WillReturnError(want)
+
+	_, err := dbx.Select[holding](mock.Context(context.Background()), "SELECT * FROM holdings")
+	if !errors.Is(err, want) {
+		t.Errorf("err = %v, want %v", err, want)
+	}
+}
+
+func TestInsertStruct(t *testing.T) {
+	type account struct {
+		ID        int64     `db:"id,pk"`
+		Name      string    `db:"name"`
+		CreatedAt time.Time `db:"created_at,readonly"`
+	}
+	created := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	mock := New(t)
+	mock.ExpectQuery(`^INSERT INTO accounts \(name\) VALUES \(\$1\) RETURNING \*$`).
+		WithArgs("alice").
+		WillReturnRows([]string{"id", "name", "created_at"}, [][]any{{int32(7), "alice", created}})
+
+	a, err := dbx.InsertStruct(mock.Context(context.Background()), "accounts", account{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 7 || a.Name != "alice" || !a.CreatedAt.Equal(created) {
+		t.Errorf("got %+v", a)
+	}
+}
+
+func TestExec(t *testing.T) {
+	mock := New(t)
+	mock.ExpectExec(`UPDATE holdings`).WithArgs(0, AnyArg()).WillReturnTag("UPDATE 3")
+
+	tag, err := dbx.Exec(mock.Context(context.Background()), "UPDATE holdings SET amount = $1 WHERE loc = $2", int64(0), "binance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.RowsAffected() != 3 {
+		t.Errorf("rows affected = %d, want 3", tag.RowsAffected())
+	}
+}
+
+func TestUnexpected(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(m *Mock)
+		call   func(ctx context.Context) error
+	}{
+		{
+			name:   "no expectations",
+			expect: func(m *Mock) {},
+			call: func(ctx context.Context) error {
+				_, err := dbx.Exec(ctx, "DELETE FROM holdings")
+				return err
+			},
+		},
+		{
+			name: "wrong kind",
+			expect: func(m *Mock) {
+				m.ExpectQuery(`DELETE`)
+			},
+			call: func(ctx context.Context) error {
+				_, err := dbx.Exec(ctx, "DELETE FROM holdings")
+				return err
+			},
+		},
+		{
+			name: "wrong SQL",
+			expect: func(m *Mock) {
+				m.ExpectExec(`UPDATE`)
+			},
+			call: func(ctx context.Context) error {
+				_, err := dbx.Exec(ctx, "DELETE FROM holdings")
+				return err
+			},
+		},
+		{
+			name: "wrong args",
+			expect: func(m *Mock) {
+				m.ExpectExec(`DELETE`).WithArgs("kraken")
+			},
+			call: func(ctx context.Context) error {
+				_, err := dbx.Exec(ctx, "DELETE FROM holdings WHERE loc = $1", "binance")
+				return err
+			},
+		},
+		{
+			name: "out of order",
+			expect: func(m *Mock) {
+				m.ExpectExec(`UPDATE`)
+				m.ExpectExec(`DELETE`)
+			},
+			call: func(ctx context.Context) error {
+				_, err := dbx.Exec(ctx, "DELETE FROM holdings")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := &fakeT{TB: t}
+			m := New(ft)
+			tt.expect(m)
+
+			err := tt.call(m.Context(context.Background()))
+			if !errors.Is(err, ErrUnexpected) {
+				t.Errorf("err = %v, want ErrUnexpected", err)
+			}
+			if len(ft.errors) != 1 || !strings.Contains(ft.errors[0], "unexpected statement") {
+				t.Errorf("reported %q, want one unexpected statement", ft.errors)
+			}
+		})
+	}
+}
+
+func TestUnmetExpectations(t *testing.T) {
+	ft := &fakeT{TB: t}
+	m := New(ft)
+	m.ExpectExec(`UPDATE holdings`)
+	m.ExpectQuery(`SELECT loc`).WithArgs("binance")
+	if _, err := dbx.Exec(m.Context(context.Background()), "UPDATE holdings SET amount = 0"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.ExpectationsWereMet()
+	if err == nil || !strings.Contains(err.Error(), `query matching "SELECT loc" with args [binance]`) {
+		t.Fatalf("err = %v, want the unmet query", err)
+	}
+	if strings.Contains(err.Error(), "UPDATE") {
+		t.Errorf("err = %v lists a met expectation", err)
+	}
+	ft.end()
+	if len(ft.errors) != 1 {
+		t.Errorf("reported %q at the end of the test, want the unmet expectation", ft.errors)
+	}
+}
+
+func TestMatchArgs(t *testing.T) {
+	var nilString *string
+	tests := []struct {
+		name string
+		want []any
+		got  []any
+		ok   bool
+	}{
+		{"any args", nil, []any{1, "x"}, true},
+		{"no args", []any{}, nil, true},
+		{"equal", []any{"binance", 1.5}, []any{"binance", 1.5}, true},
+		{"int widths", []any{1}, []any{int64(1)}, true},
+		{"unsigned", []any{uint8(3)}, []any{int32(3)}, true},
+		{"float widths", []any{float32(0.5)}, []any{0.5}, true},
+		{"typed nil", []any{nil}, []any{nilString}, true},
+		{"nil slice", []any{nil}, []any{[]byte(nil)}, true},
+		{"any arg", []any{AnyArg(), "x"}, []any{struct{}{}, "x"}, true},
+		{"different value", []any{"binance"}, []any{"kraken"}, false},
+		{"int and float", []any{1}, []any{1.0}, false},
+		{"too few", []any{1, 2}, []any{1}, false},
+		{"too many", []any{1}, []any{1, 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Expectation{kind: "exec", pattern: regexpAll}
+			if tt.want != nil {
+				e.WithArgs(tt.want...)
+			}
+			if got := e.matches("exec", "SELECT 1", tt.got); got != tt.ok {
+				t.Errorf("matches = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAssign(t *testing.T) {
+	type currency string
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		dest    func() any // returns a pointer to a zero destination
+		value   any
+		want    any // the value dest points to afterwards
+		wantErr bool
+	}{
+		{"string", func() any { return new(string) }, "btc", "btc", false},
+		{"named string", func() any { return new(currency) }, "btc", currency("btc"), false},
+		{"int conversion", func() any { return new(int64) }, 7, int64(7), false},
+		{"int to float", func() any { return new(float64) }, int32(2), 2.0, false},
+		{"time", func() any { return new(time.Time) }, created, created, false},
+		{"pointer allocation", func() any { return new(*string) }, "note", ptr("note"), false},
+		{"pointer conversion", func() any { return new(*int64) }, 3, ptr(int64(3)), false},
+		{"null pointer", func() any { p := ptr("old"); return &p }, nil, (*string)(nil), false},
+		{"null slice", func() any { return &[]byte{1} }, nil, []byte(nil), false},
+		{"null interface", func() any { var v any = 1; return &v }, nil, nil, false},
+		{"any", func() any { return new(any) }, "x", "x", false},
+		{"scanner", func() any { return new(pgtype.Text) }, "x", pgtype.Text{String: "x", Valid: true}, false},
+		{"null into string", func() any { return new(string) }, nil, "", true},
+		{"int into string", func() any { return new(string) }, 65, "", true},
+		{"string into int", func() any { return new(int) }, "1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := tt.dest()
+			err := assign(dest, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := reflect.ValueOf(dest).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if err := assign(holding{}, "x"); err == nil {
+		t.Error("assign to a non-pointer succeeded")
+	}
+}
+
+var regexpAll = regexp.MustCompile(`.*`)
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,152 @@
+package dbxmock
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// rows implements pgx.Rows over scripted values
+type rows struct {
+	fields []pgconn.FieldDescription
+	values [][]any
+	pos    int // 1-based index of the current row
+	closed bool
+	err    error
+}
+
+func newRows(columns []string, values [][]any) *rows {
+	fields := make([]pgconn.FieldDescription, len(columns))
+	for i, c := range columns {
+		fields[i] = pgconn.FieldDescription{Name: c}
+	}
+	return &rows{fields: fields, values: values}
+}
+
+func (r *rows) Close() {
+	r.closed = true
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.values)))
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	return r.fields
+}
+
+func (r *rows) Next() bool {
+	if r.closed || r.err != nil || r.pos >= len(r.values) {
+		r.closed = true
+		return false
+	}
+	r.pos++
+	if len(r.values[r.pos-1]) != len(r.fields) {
+		r.err = fmt.Errorf("dbxmock: row %d has %d values for %d columns", r.pos, len(r.values[r.pos-1]), len(r.fields))
+		r.closed = true
+		return false
+	}
+	return true
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if r.pos == 0 || r.closed {
+		return fmt.Errorf("dbxmock: Scan called without a current row")
+	}
+	if len(dest) != len(r.fields) {
+		return fmt.Errorf("dbxmock: Scan got %d destinations for %d columns", len(dest), len(r.fields))
+	}
+	for i, d := range dest {
+		if d == nil {
+			continue
+		}
+		if err := assign(d, r.values[r.pos-1][i]); err != nil {
+			return fmt.Errorf("dbxmock: column %q: %w", r.fields[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) {
+	if r.pos == 0 || r.closed {
+		return nil, fmt.Errorf("dbxmock: Values called without a current row")
+	}
+	return r.values[r.pos-1], nil
+}
+
+func (r *rows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *rows) Conn() *pgx.Conn {
+	return nil
+}
+
+// assign stores v in the pointer dest, as scanning a column would
+func assign(dest, v any) error {
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(v)
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination %T is not a non-nil pointer", dest)
+	}
+	target := dv.Elem()
+	if v == nil {
+		switch target.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			target.SetZero()
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s", target.Type())
+	}
+
+	val := reflect.ValueOf(v)
+	if target.Kind() == reflect.Pointer && !val.Type().AssignableTo(target.Type()) {
+		// allocate for nullable fields, e.g. a string into *string
+		p := reflect.New(target.Type().Elem())
+		if err := assign(p.Interface(), v); err != nil {
+			return err
+		}
+		target.Set(p)
+		return nil
+	}
+	switch {
+	case val.Type().AssignableTo(target.Type()):
+		target.Set(val)
+	case val.Type().ConvertibleTo(target.Type()) && val.Kind() != reflect.String && target.Kind() != reflect.String:
+		target.Set(val.Convert(target.Type()))
+	case val.Kind() == reflect.String && target.Kind() == reflect.String:
+		target.SetString(val.String())
+	default:
+		return fmt.Errorf("cannot scan %T into %s", v, target.Type())
+	}
+	return nil
+}
+
+// row implements pgx.Row for QueryRow
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
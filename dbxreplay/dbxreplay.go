@@ -0,0 +1,175 @@
+// Package dbxreplay records the statements run by a test and their results into a golden file,
+// and replays them later without a database.
+//
+//	func TestHoldings(t *testing.T) {
+//		ctx := context.Background()
+//		if dbxreplay.Recording() {
+//			ctx = dbxtest.New(t)
+//		}
+//		ctx = dbxreplay.Context(t, ctx, "testdata/holdings.json")
+//		...
+//	}
+//
+// Run the tests with DBX_RECORD=1 against a database to refresh the golden files.
+// Values are stored in the PostgreSQL text format together with their type OIDs, so replayed
+// rows scan into the same Go types as rows from the server. Types registered on the recording
+// connection, such as enums and composite types, must be known when replaying too: pass a map
+// with them using WithTypeMap.
+package dbxreplay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx"
+)
+
+// EnvRecord names the variable that switches Context from replaying to recording
+const EnvRecord = "DBX_RECORD"
+
+// Recording reports whether EnvRecord is set
+func Recording() bool {
+	return os.Getenv(EnvRecord) != ""
+}
+
+// File is the content of a golden file
+type File struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded statement and its result
+type Interaction struct {
+	Kind    string            `json:"kind"` // "query" or "exec"
+	SQL     string            `json:"sql"`
+	Args    []json.RawMessage `json:"args,omitempty"`
+	Columns []Column          `json:"columns,omitempty"`
+	Rows    [][]*string       `json:"rows,omitempty"` // text format, nil for NULL
+	Tag     string            `json:"tag,omitempty"`
+
+	Error     *Error `json:"error,omitempty"`      // error of the statement
+	RowsError *Error `json:"rows_error,omitempty"` // error ending the rows after they were read
+}
+
+// Column is a recorded result column
+type Column struct {
+	Name string `json:"name"`
+	OID  uint32 `json:"oid"`
+}
+
+// Error is a recorded error. Errors with a code are replayed as *pgconn.PgError.
+type Error struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func newError(err error) *Error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return &Error{Code: pgErr.Code, Message: pgErr.Message}
+	}
+	return &Error{Message: err.Error()}
+}
+
+func (e *Error) err() error {
+	if e == nil {
+		return nil
+	}
+	if e.Code != "" {
+		return &pgconn.PgError{Severity: "ERROR", Code: e.Code, Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+// Option configures a Recorder or a Replayer
+type Option func(*options)
+
+type options struct {
+	typeMap *pgtype.Map
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithTypeMap encodes and decodes values with m instead of the map of the recording connection,
+// or a map of the built-in types when replaying
+func WithTypeMap(m *pgtype.Map) Option {
+	return func(o *options) {
+		o.typeMap = m
+	}
+}
+
+// Context returns a context that makes the package-level dbx functions replay the golden file at path.
+// When Recording, the statements run on the querier of ctx instead and are written to path when the test ends.
+func Context(t testing.TB, ctx context.Context, path string, opts ...Option) context.Context {
+	t.Helper()
+	if Recording() {
+		r := NewRecorder(dbx.QuerierFrom(ctx), opts...)
+		t.Cleanup(func() {
+			if err := r.Save(path); err != nil {
+				t.Errorf("dbxreplay: %v", err)
+			}
+		})
+		return dbx.WithQuerier(ctx, r)
+	}
+
+	p, err := Load(path, opts...)
+	if err != nil {
+		t.Fatalf("dbxreplay: %v (record it with %s=1)", err, EnvRecord)
+	}
+	t.Cleanup(func() {
+		if err := p.Done(); err != nil {
+			t.Error(err)
+		}
+	})
+	return dbx.WithQuerier(ctx, p)
+}
+
+// readFile reads a golden file
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// writeFile writes a golden file, creating its directory
+func writeFile(path string, f *File) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// encodeArgs returns args as JSON for comparison
+func encodeArgs(args []any) []json.RawMessage {
+	encoded := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(arg))
+		}
+		encoded[i] = data
+	}
+	return encoded
+}
@@ -0,0 +1,131 @@
+package dbxreplay
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/dbxmock"
+)
+
+type mood string
+
+// moodMap returns a type map with a mood enum and its array type, as registered on a connection
+func moodMap() *pgtype.Map {
+	m := pgtype.NewMap()
+	moodType := &pgtype.Type{Name: "mood", OID: 90001, Codec: &pgtype.EnumCodec{}}
+	m.RegisterType(moodType)
+	m.RegisterType(&pgtype.Type{Name: "_mood", OID: 90002, Codec: &pgtype.ArrayCodec{ElementType: moodType}})
+	m.RegisterDefaultPgType(mood(""), "mood")
+	m.RegisterDefaultPgType([]mood{}, "_mood")
+	return m
+}
+
+type result struct {
+	id      int64
+	name    *string
+	moods   []mood
+	created time.Time
+}
+
+// run is the test body, run once through the Recorder and once through the Replayer
+func run(ctx context.Context, q dbx.Querier) ([]result, error) {
+	rows, err := q.Query(ctx, "SELECT id, name, moods, created FROM people WHERE id > $1", 0)
+	if err != nil {
+		return nil, err
+	}
+	var results []result
+	for rows.Next() {
+		var r result
+		if err := rows.Scan(&r.id, &r.name, &r.moods, &r.created); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var n int64
+	if err := q.QueryRow(ctx, "SELECT count(*) FROM people").Scan(&n); err != nil {
+		return nil, err
+	}
+	if n != int64(len(results)) {
+		return nil, errors.New("count does not match the rows")
+	}
+	if _, err := q.Exec(ctx, "DELETE FROM people WHERE id = $1", 2); err != nil {
+		return nil, err
+	}
+	var pgErr *pgconn.PgError
+	if _, err := q.Exec(ctx, "DELETE FROM missing"); !errors.As(err, &pgErr) || pgErr.Code != "42P01" {
+		return nil, errors.New("recorded error was not returned")
+	}
+	return results, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	name := "ada"
+
+	mock := dbxmock.New(t)
+	mock.ExpectQuery(`SELECT id, name, moods, created FROM people`).WithArgs(0).WillReturnRows(
+		[]string{"id", "name", "moods", "created"},
+		[][]any{
+			{int64(1), name, []mood{"happy", "sad"}, created},
+			{int64(2), nil, []mood{}, created},
+		})
+	mock.ExpectQuery(`SELECT count`).WillReturnRows([]string{"count"}, [][]any{{int64(2)}})
+	mock.ExpectExec(`DELETE FROM people`).WithArgs(2).WillReturnTag("DELETE 1")
+	mock.ExpectExec(`DELETE FROM missing`).WillReturnError(&pgconn.PgError{Code: "42P01", Message: `relation "missing" does not exist`})
+
+	path := filepath.Join(t.TempDir(), "golden.json")
+	rec := NewRecorder(mock, WithTypeMap(moodMap()))
+	recorded, err := run(ctx, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Load(path, WithTypeMap(moodMap()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := run(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Done(); err != nil {
+		t.Error(err)
+	}
+
+	for _, results := range [][]result{recorded, replayed} {
+		if len(results) != 2 {
+			t.Fatalf("got %d rows, want 2", len(results))
+		}
+		r := results[0]
+		if r.id != 1 || r.name == nil || *r.name != name || !slices.Equal(r.moods, []mood{"happy", "sad"}) || !r.created.Equal(created) {
+			t.Errorf("row 1 = %+v", r)
+		}
+		if r := results[1]; r.id != 2 || r.name != nil || len(r.moods) != 0 {
+			t.Errorf("row 2 = %+v", r)
+		}
+	}
+
+	// the built-in types do not know the enum array
+	p, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(ctx, p); err == nil {
+		t.Error("replayed the enum array without its type")
+	}
+}
@@ -0,0 +1,125 @@
+package dbxreplay
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx"
+)
+
+// Recorder is a dbx.Querier that runs statements on another querier and records them with their results
+type Recorder struct {
+	q       dbx.Querier
+	typeMap *pgtype.Map // nil to use the map of the connection rows come from
+
+	mu   sync.Mutex
+	file File
+}
+
+var _ dbx.Querier = (*Recorder)(nil)
+
+// NewRecorder returns a recorder running statements on q
+func NewRecorder(q dbx.Querier, opts ...Option) *Recorder {
+	o := newOptions(opts)
+	return &Recorder{q: q, typeMap: o.typeMap}
+}
+
+// Save writes the recorded statements to the golden file at path
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return writeFile(path, &r.file)
+}
+
+func (r *Recorder) add(in *Interaction) {
+	r.mu.Lock()
+	r.file.Interactions = append(r.file.Interactions, *in)
+	r.mu.Unlock()
+}
+
+// Query runs the query and reads all rows, which are recorded and returned from the recording
+func (r *Recorder) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	in := &Interaction{Kind: "query", SQL: sql, Args: encodeArgs(args)}
+	rows, err := r.q.Query(ctx, sql, args...)
+	if err != nil {
+		in.Error = newError(err)
+		r.add(in)
+		return nil, err
+	}
+	m := r.typeMap
+	if m == nil {
+		m = pgtype.NewMap()
+		if c := rows.Conn(); c != nil {
+			m = c.TypeMap()
+		}
+	}
+	if err := record(in, rows, m); err != nil {
+		return nil, err
+	}
+	r.add(in)
+	return newRows(in, m), nil
+}
+
+// QueryRow runs the query like Query and returns its first row
+func (r *Recorder) QueryRow(ctx context.Context, sql string, args ...any) dbx.Row {
+	rows, err := r.Query(ctx, sql, args...)
+	return &row{rows: rows, err: err}
+}
+
+// Exec runs the statement and records its command tag
+func (r *Recorder) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	in := &Interaction{Kind: "exec", SQL: sql, Args: encodeArgs(args)}
+	tag, err := r.q.Exec(ctx, sql, args...)
+	if err != nil {
+		in.Error = newError(err)
+	}
+	in.Tag = tag.String()
+	r.add(in)
+	return tag, err
+}
+
+// record reads rows into in, encoding values in the text format with m.
+// Columns without a type OID, as from a fake querier, get the OID m has for their values.
+// An error ending the rows is recorded too; the returned error is one of encoding.
+func record(in *Interaction, rows dbx.Rows, m *pgtype.Map) error {
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	in.Columns = make([]Column, len(fields))
+	for i, fd := range fields {
+		in.Columns[i] = Column{Name: fd.Name, OID: fd.DataTypeOID}
+	}
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			in.RowsError = newError(err)
+			break
+		}
+		row := make([]*string, len(values))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			if in.Columns[i].OID == 0 {
+				if t, ok := m.TypeForValue(v); ok {
+					in.Columns[i].OID = t.OID
+				}
+			}
+			buf, err := m.Encode(in.Columns[i].OID, pgtype.TextFormatCode, v, nil)
+			if err != nil {
+				return err
+			}
+			s := string(buf)
+			row[i] = &s
+		}
+		in.Rows = append(in.Rows, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil && in.RowsError == nil {
+		in.RowsError = newError(err)
+	}
+	in.Tag = rows.CommandTag().String()
+	return nil
+}
@@ -0,0 +1,98 @@
+package dbxreplay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx"
+)
+
+// Replayer is a dbx.Querier serving the statements of a golden file in the order they were recorded
+type Replayer struct {
+	path    string
+	file    *File
+	typeMap *pgtype.Map
+
+	mu   sync.Mutex
+	next int // index of the next interaction
+}
+
+var _ dbx.Querier = (*Replayer)(nil)
+
+// Load reads the golden file at path
+func Load(path string, opts ...Option) (*Replayer, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := newOptions(opts).typeMap
+	if m == nil {
+		m = pgtype.NewMap()
+	}
+	return &Replayer{path: path, file: f, typeMap: m}, nil
+}
+
+// Done returns an error if recorded statements were not replayed
+func (p *Replayer) Done() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if left := len(p.file.Interactions) - p.next; left > 0 {
+		return fmt.Errorf("dbxreplay: %s: %d recorded statements were not run, next %q", p.path, left, p.file.Interactions[p.next].SQL)
+	}
+	return nil
+}
+
+// take returns the next interaction if it matches the statement
+func (p *Replayer) take(kind, sql string, args []any) (*Interaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= len(p.file.Interactions) {
+		return nil, fmt.Errorf("dbxreplay: %s: unexpected %s %q, all recorded statements were run", p.path, kind, sql)
+	}
+	in := &p.file.Interactions[p.next]
+	if in.Kind != kind || in.SQL != sql {
+		return nil, fmt.Errorf("dbxreplay: %s: statement %d is %s %q, recorded as %s %q", p.path, p.next+1, kind, sql, in.Kind, in.SQL)
+	}
+	encoded := encodeArgs(args)
+	if len(encoded) != len(in.Args) {
+		return nil, fmt.Errorf("dbxreplay: %s: statement %d %q has %d args, recorded with %d", p.path, p.next+1, sql, len(encoded), len(in.Args))
+	}
+	for i := range encoded {
+		if !bytes.Equal(encoded[i], in.Args[i]) {
+			return nil, fmt.Errorf("dbxreplay: %s: statement %d %q has arg $%d %s, recorded as %s", p.path, p.next+1, sql, i+1, encoded[i], in.Args[i])
+		}
+	}
+	p.next++
+	return in, nil
+}
+
+// Query returns the recorded rows or error
+func (p *Replayer) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	in, err := p.take("query", sql, args)
+	if err != nil {
+		return nil, err
+	}
+	if in.Error != nil {
+		return nil, in.Error.err()
+	}
+	return newRows(in, p.typeMap), nil
+}
+
+// QueryRow returns the first recorded row
+func (p *Replayer) QueryRow(ctx context.Context, sql string, args ...any) dbx.Row {
+	rows, err := p.Query(ctx, sql, args...)
+	return &row{rows: rows, err: err}
+}
+
+// Exec returns the recorded command tag or error
+func (p *Replayer) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	in, err := p.take("exec", sql, args)
+	if err != nil {
+		return dbx.CommandTag{}, err
+	}
+	return pgconn.NewCommandTag(in.Tag), in.Error.err()
+}
@@ -0,0 +1,148 @@
+package dbxreplay
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// rows implements pgx.Rows over a recorded result, decoding values like pgx does for the text format
+type rows struct {
+	in     *Interaction
+	m      *pgtype.Map
+	fields []pgconn.FieldDescription
+	pos    int // 1-based index of the current row
+	closed bool
+	err    error
+}
+
+func newRows(in *Interaction, m *pgtype.Map) *rows {
+	fields := make([]pgconn.FieldDescription, len(in.Columns))
+	for i, c := range in.Columns {
+		fields[i] = pgconn.FieldDescription{Name: c.Name, DataTypeOID: c.OID, Format: pgtype.TextFormatCode}
+	}
+	return &rows{in: in, m: m, fields: fields}
+}
+
+func (r *rows) Close() {
+	r.closed = true
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(r.in.Tag)
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	return r.fields
+}
+
+func (r *rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	if r.pos >= len(r.in.Rows) {
+		r.closed = true
+		r.err = r.in.RowsError.err()
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *rows) current() ([]*string, error) {
+	if r.pos == 0 || r.closed {
+		return nil, fmt.Errorf("dbxreplay: no current row")
+	}
+	return r.in.Rows[r.pos-1], nil
+}
+
+func (r *rows) Scan(dest ...any) error {
+	row, err := r.current()
+	if err != nil {
+		return err
+	}
+	if len(dest) != len(r.fields) {
+		return fmt.Errorf("dbxreplay: Scan got %d destinations for %d columns", len(dest), len(r.fields))
+	}
+	for i, d := range dest {
+		if d == nil {
+			continue
+		}
+		if err := r.m.Scan(r.fields[i].DataTypeOID, pgtype.TextFormatCode, raw(row[i]), d); err != nil {
+			return fmt.Errorf("dbxreplay: column %q: %w", r.fields[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) {
+	row, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(row))
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		t, ok := r.m.TypeForOID(r.fields[i].DataTypeOID)
+		if !ok {
+			values[i] = *v
+			continue
+		}
+		if values[i], err = t.Codec.DecodeValue(r.m, t.OID, pgtype.TextFormatCode, raw(v)); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (r *rows) RawValues() [][]byte {
+	row, err := r.current()
+	if err != nil {
+		return nil
+	}
+	values := make([][]byte, len(row))
+	for i, v := range row {
+		values[i] = raw(v)
+	}
+	return values
+}
+
+func (r *rows) Conn() *pgx.Conn {
+	return nil
+}
+
+// raw returns a recorded value as bytes, nil for NULL
+func raw(v *string) []byte {
+	if v == nil {
+		return nil
+	}
+	return []byte(*v)
+}
+
+// row implements pgx.Row for QueryRow
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
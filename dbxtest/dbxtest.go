@@ -0,0 +1,117 @@
+// Package dbxtest runs integration tests of code built on dbx against a real database.
+//
+// New gives every test its own connection and transaction, which is rolled back when the
+// test ends, so tests can run in parallel against one database without cleaning up tables.
+// FreshDB gives a test its own database instead, copied from a migrated template.
+package dbxtest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+)
+
+// EnvURL names the variable holding the connection string of the test database.
+// When it is not set, DATABASE_URL and the PG* variables are used as by dbx.ResolveConfig.
+const EnvURL = "DBX_TEST_DATABASE_URL"
+
+// Option configures New, FreshDB and LoadFixtures
+type Option func(*options)
+
+type options struct {
+	connString string
+	setDefault bool
+	template   string
+	truncate   bool
+}
+
+// WithConnString connects to connString instead of the configured test database.
+// For FreshDB it is the server the database is created on.
+func WithConnString(connString string) Option {
+	return func(o *options) {
+		o.connString = connString
+	}
+}
+
+// WithDefault also installs the test's transaction or connection with dbx.SetDefault, for code that does not pass
+// the context along. The default querier is global, so such tests must not run in parallel.
+func WithDefault() Option {
+	return func(o *options) {
+		o.setDefault = true
+	}
+}
+
+// defaultMu serializes tests using WithDefault
+var defaultMu sync.Mutex
+
+// New connects to the test database and begins a transaction that is rolled back when the test ends.
+// The returned context makes dbx.Query, dbx.Exec, dbx.Get, dbx.Select, dbx.InsertStruct and the
+// other package-level functions run inside the transaction; dbx.Begin starts a savepoint.
+// The test is skipped if no test database is configured.
+func New(t testing.TB, opts ...Option) context.Context {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	conn := connect(t, o.connString)
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("dbxtest: begin: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(context.Background()); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			t.Errorf("dbxtest: rollback: %v", err)
+		}
+	})
+
+	if o.setDefault {
+		defaultMu.Lock()
+		dbx.SetDefault(tx)
+		t.Cleanup(func() {
+			dbx.SetDefault(nil)
+			defaultMu.Unlock()
+		})
+	}
+	return dbx.WithQuerier(t.Context(), tx)
+}
+
+// Config returns the config of the test database, or skips the test if none is configured
+func Config(t testing.TB) *pgx.ConnConfig {
+	t.Helper()
+	return config(t, "")
+}
+
+func config(t testing.TB, connString string) *pgx.ConnConfig {
+	t.Helper()
+	if connString == "" {
+		connString = os.Getenv(EnvURL)
+	}
+	config, err := dbx.ResolveConfig(connString)
+	if errors.Is(err, dbx.ErrNoConfig) {
+		t.Skipf("dbxtest: no test database: set %s or DATABASE_URL", EnvURL)
+	}
+	if err != nil {
+		t.Fatalf("dbxtest: %v", err)
+	}
+	return config.ConnConfig
+}
+
+// connect opens a connection that is closed when the test ends
+func connect(t testing.TB, connString string) *pgx.Conn {
+	t.Helper()
+	conn, err := pgx.ConnectConfig(context.Background(), config(t, connString))
+	if err != nil {
+		t.Fatalf("dbxtest: connect: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close(context.Background())
+	})
+	return conn
+}
@@ -0,0 +1,278 @@
+package dbxtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// WithTruncate makes LoadFixtures empty the fixture tables first, so fixtures can be reloaded between tests.
+// The tables are truncated with CASCADE, which also empties tables referencing them that have no fixtures.
+func WithTruncate() Option {
+	return func(o *options) {
+		o.truncate = true
+	}
+}
+
+// fixtureFuncs are the functions available in fixture templates
+var fixtureFuncs = template.FuncMap{
+	// now returns the current time, e.g. {{ now }}
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	},
+	// ago returns the current time minus a duration, e.g. {{ ago "36h" }}
+	"ago": func(d string) (string, error) {
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return "", err
+		}
+		return time.Now().UTC().Add(-duration).Format(time.RFC3339Nano), nil
+	},
+}
+
+// fixtureTable is the rows of one table read from fixture files
+type fixtureTable struct {
+	name string
+	desc *schema.Table
+	rows []map[string]any
+}
+
+// LoadFixtures inserts the rows in the YAML or JSON files of fsys matching pattern, using the querier of ctx,
+// e.g. the transaction of New. A file maps table names to lists of rows, or is a list of rows for the
+// table named like the file:
+//
+//	holdings:
+//	  - loc: binance
+//	    currency: btc
+//	    amount: 1.5
+//	    ts: "{{ now }}"
+//
+// Files are templates with the functions now and ago. Tables are filled in foreign key order, and
+// afterwards the sequences of serial and identity columns are set past the inserted values.
+func LoadFixtures(ctx context.Context, fsys fs.FS, pattern string, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("dbxtest: fixtures: %w", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("dbxtest: fixtures: no files match %s", pattern)
+	}
+
+	tables := make(map[string]*fixtureTable)
+	var names []string
+	for _, file := range files {
+		rows, err := readFixture(fsys, file)
+		if err != nil {
+			return fmt.Errorf("dbxtest: fixtures: %s: %w", file, err)
+		}
+		for name, r := range rows {
+			t, ok := tables[name]
+			if !ok {
+				t = &fixtureTable{name: name}
+				tables[name] = t
+				names = append(names, name)
+			}
+			t.rows = append(t.rows, r...)
+		}
+	}
+
+	for _, t := range tables {
+		if t.desc, err = schema.DescribeTable(ctx, dbx.QuerierFrom(ctx), t.name); err != nil {
+			return fmt.Errorf("dbxtest: fixtures: %w", err)
+		}
+	}
+	ordered, err := fkOrder(tables, names)
+	if err != nil {
+		return err
+	}
+
+	if o.truncate {
+		idents := make([]string, len(ordered))
+		for i, t := range ordered {
+			idents[i] = pgx.Identifier{t.desc.Schema, t.desc.Name}.Sanitize()
+		}
+		if _, err := dbx.Exec(ctx, "TRUNCATE "+strings.Join(idents, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+			return fmt.Errorf("dbxtest: fixtures: %w", err)
+		}
+	}
+
+	for _, t := range ordered {
+		if err := insertFixtures(ctx, t); err != nil {
+			return fmt.Errorf("dbxtest: fixtures: %s: %w", t.name, err)
+		}
+		if err := resetSequences(ctx, t.desc); err != nil {
+			return fmt.Errorf("dbxtest: fixtures: %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// readFixture executes the template in file and returns its rows by table
+func readFixture(fsys fs.FS, file string) (map[string][]map[string]any, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(file).Funcs(fixtureFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, so one decoder reads both
+	var doc any
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return nil, err
+	}
+	switch doc := doc.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+		rows, err := fixtureRows(doc)
+		return map[string][]map[string]any{name: rows}, err
+	case map[string]any:
+		tables := make(map[string][]map[string]any)
+		for name, v := range doc {
+			list, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("table %s: expected a list of rows", name)
+			}
+			if tables[name], err = fixtureRows(list); err != nil {
+				return nil, fmt.Errorf("table %s: %w", name, err)
+			}
+		}
+		return tables, nil
+	}
+	return nil, fmt.Errorf("expected a map of tables or a list of rows")
+}
+
+func fixtureRows(list []any) ([]map[string]any, error) {
+	rows := make([]map[string]any, len(list))
+	for i, v := range list {
+		row, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("row %d: expected a map of columns", i+1)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// fkOrder sorts the tables so that every table comes after the tables it references.
+// References to tables without fixtures and to the table itself are ignored.
+func fkOrder(tables map[string]*fixtureTable, names []string) ([]*fixtureTable, error) {
+	byName := make(map[string]*fixtureTable)
+	for _, t := range tables {
+		byName[t.desc.Schema+"."+t.desc.Name] = t
+	}
+	sort.Strings(names)
+
+	var ordered []*fixtureTable
+	state := make(map[*fixtureTable]int) // 1 visiting, 2 done
+	var visit func(t *fixtureTable, path []string) error
+	visit = func(t *fixtureTable, path []string) error {
+		switch state[t] {
+		case 1:
+			return fmt.Errorf("dbxtest: fixtures: foreign key cycle %s", strings.Join(append(path, t.name), " -> "))
+		case 2:
+			return nil
+		}
+		state[t] = 1
+		for _, fk := range t.desc.ForeignKeys {
+			ref, ok := byName[fk.RefSchema+"."+fk.RefTable]
+			if !ok || ref == t {
+				continue
+			}
+			if err := visit(ref, append(path, t.name)); err != nil {
+				return err
+			}
+		}
+		state[t] = 2
+		ordered = append(ordered, t)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(tables[name], nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// insertFixtures inserts the rows of t, encoding maps and lists as JSON for json and jsonb columns
+func insertFixtures(ctx context.Context, t *fixtureTable) error {
+	table := pgx.Identifier{t.desc.Schema, t.desc.Name}.Sanitize()
+	for i, row := range t.rows {
+		columns := make([]string, 0, len(row))
+		for c := range row {
+			columns = append(columns, c)
+		}
+		sort.Strings(columns)
+
+		idents := make([]string, len(columns))
+		placeholders := make([]string, len(columns))
+		values := make([]any, len(columns))
+		for j, c := range columns {
+			col := t.desc.Column(c)
+			if col == nil {
+				return fmt.Errorf("row %d: column %q does not exist", i+1, c)
+			}
+			idents[j] = pgx.Identifier{c}.Sanitize()
+			placeholders[j] = fmt.Sprintf("$%d", j+1)
+			values[j] = row[c]
+			if slices.Contains([]string{"json", "jsonb"}, col.TypeName) && row[c] != nil {
+				data, err := json.Marshal(row[c])
+				if err != nil {
+					return fmt.Errorf("row %d: column %q: %w", i+1, c, err)
+				}
+				values[j] = string(data)
+			}
+		}
+
+		sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(idents, ", "), strings.Join(placeholders, ", "))
+		if _, err := dbx.Exec(ctx, sql, values...); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// resetSequences sets the sequences of serial and identity columns past the largest value in the table
+func resetSequences(ctx context.Context, t *schema.Table) error {
+	table := pgx.Identifier{t.Schema, t.Name}.Sanitize()
+	for _, col := range t.Columns {
+		serial := col.Default != nil && strings.HasPrefix(*col.Default, "nextval(")
+		if col.Identity == "" && !serial {
+			continue
+		}
+		ident := pgx.Identifier{col.Name}.Sanitize()
+		sql := fmt.Sprintf("SELECT setval(seq, COALESCE(MAX(%s), 1), MAX(%s) IS NOT NULL) FROM %s, pg_get_serial_sequence($1, $2) AS seq WHERE seq IS NOT NULL GROUP BY seq",
+			ident, ident, table)
+		if _, err := dbx.Exec(ctx, sql, table, col.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
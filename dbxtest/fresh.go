@@ -0,0 +1,115 @@
+package dbxtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/migrate"
+)
+
+// EnvTemplate names the variable holding the template database used by FreshDB
+const EnvTemplate = "DBX_TEST_TEMPLATE"
+
+// WithTemplate makes FreshDB copy template instead of the database named by EnvTemplate
+func WithTemplate(template string) Option {
+	return func(o *options) {
+		o.template = template
+	}
+}
+
+// FreshDB creates a database for the test with CREATE DATABASE ... TEMPLATE and drops it when the test ends.
+// Use it instead of New for tests that commit, use LISTEN/NOTIFY or run DDL.
+//
+// The template is the database named by WithTemplate or EnvTemplate, template1 if neither is set;
+// CreateTemplate prepares one from migrations. The returned context makes the package-level functions
+// use a connection to the new database, and the config can open more connections, e.g. with dbx.NewListener.
+func FreshDB(t testing.TB, opts ...Option) (context.Context, *pgx.ConnConfig) {
+	t.Helper()
+	o := &options{template: os.Getenv(EnvTemplate)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.template == "" {
+		o.template = "template1"
+	}
+
+	admin := connect(t, o.connString)
+	name := "dbxtest_" + randomHex(8)
+	_, err := admin.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s",
+		pgx.Identifier{name}.Sanitize(), pgx.Identifier{o.template}.Sanitize()))
+	if err != nil {
+		t.Fatalf("dbxtest: create database from %s: %v", o.template, err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+pgx.Identifier{name}.Sanitize()+" WITH (FORCE)")
+		if err != nil {
+			t.Errorf("dbxtest: drop database %s: %v", name, err)
+		}
+	})
+
+	config := admin.Config().Copy()
+	config.Database = name
+	conn, err := pgx.ConnectConfig(context.Background(), config)
+	if err != nil {
+		t.Fatalf("dbxtest: connect to %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		conn.Close(context.Background())
+	})
+
+	if o.setDefault {
+		defaultMu.Lock()
+		dbx.SetDefault(conn)
+		t.Cleanup(func() {
+			dbx.SetDefault(nil)
+			defaultMu.Unlock()
+		})
+	}
+	return dbx.WithQuerier(t.Context(), conn), config
+}
+
+// CreateTemplate (re)creates the database name and applies the migrations in fsys to it,
+// so that FreshDB can copy it. It is meant to be called once from TestMain.
+func CreateTemplate(ctx context.Context, config *pgx.ConnConfig, name string, fsys fs.FS) error {
+	admin, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer admin.Close(ctx)
+
+	ident := pgx.Identifier{name}.Sanitize()
+	if _, err := admin.Exec(ctx, "DROP DATABASE IF EXISTS "+ident+" WITH (FORCE)"); err != nil {
+		return err
+	}
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+ident); err != nil {
+		return err
+	}
+
+	config = config.Copy()
+	config.Database = name
+	// the template must have no other connections when it is copied, so this one is closed before returning
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	m, err := migrate.New(conn, fsys)
+	if err != nil {
+		return err
+	}
+	return m.Up(ctx)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
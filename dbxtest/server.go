@@ -0,0 +1,244 @@
+package dbxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx/migrate"
+)
+
+// ErrNoPostgres is returned by StartServer when initdb and pg_ctl cannot be found
+var ErrNoPostgres = errors.New("dbxtest: PostgreSQL binaries not found")
+
+// ErrCannotInitdb is returned by StartServer when initdb cannot run here, e.g. as root, as is common in CI containers
+var ErrCannotInitdb = errors.New("dbxtest: cannot run initdb")
+
+// ServerOptions configures StartServer
+type ServerOptions struct {
+	BinDir     string        // directory holding initdb and pg_ctl; found in PATH, with pg_config or in /usr/lib/postgresql if empty
+	Migrations fs.FS         // applied to the postgres database if not nil
+	Template   string        // if set, a template database with the migrations is also created for FreshDB
+	Timeout    time.Duration // how long to wait for the server to accept connections, 30s if zero
+}
+
+// Server is a throwaway PostgreSQL server in a temporary directory
+type Server struct {
+	ConnString string // connection string of the postgres database
+
+	dir    string
+	pgCtl  string
+	config *pgx.ConnConfig
+}
+
+// StartServer starts a PostgreSQL server from locally installed binaries with initdb and pg_ctl,
+// in a temporary directory and on a random port, and waits until it accepts connections.
+// Stop shuts it down and removes the directory. initdb refuses to run as root, in which case
+// the error wraps ErrCannotInitdb.
+func StartServer(ctx context.Context, opts *ServerOptions) (*Server, error) {
+	if opts == nil {
+		opts = &ServerOptions{}
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	binDir, err := findBinDir(opts.BinDir)
+	if err != nil {
+		return nil, err
+	}
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("%w: refusing to run as root", ErrCannotInitdb)
+	}
+	dir, err := os.MkdirTemp("", "dbxtest-pg-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{dir: dir, pgCtl: filepath.Join(binDir, "pg_ctl")}
+	data := filepath.Join(dir, "data")
+
+	initdb := exec.CommandContext(ctx, filepath.Join(binDir, "initdb"),
+		"-D", data, "--username=postgres", "--auth=trust", "--encoding=UTF8", "--no-sync")
+	if out, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			// initdb did not start, e.g. it is not executable
+			return nil, fmt.Errorf("%w: %w", ErrCannotInitdb, err)
+		}
+		return nil, fmt.Errorf("dbxtest: initdb: %w\n%s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	serverOpts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off -c full_page_writes=off", port, dir)
+	start := exec.CommandContext(ctx, s.pgCtl, "-D", data, "-l", s.logFile(), "-o", serverOpts, "-W", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("dbxtest: pg_ctl start: %w\n%s", err, out)
+	}
+
+	s.ConnString = fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+	if s.config, err = pgx.ParseConfig(s.ConnString); err != nil {
+		s.Stop()
+		return nil, err
+	}
+	if err := s.waitReady(ctx, timeout); err != nil {
+		s.Stop()
+		return nil, err
+	}
+
+	if opts.Migrations != nil {
+		if err := s.migrate(ctx, opts.Migrations); err != nil {
+			s.Stop()
+			return nil, err
+		}
+		if opts.Template != "" {
+			if err := CreateTemplate(ctx, s.config, opts.Template, opts.Migrations); err != nil {
+				s.Stop()
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// Stop shuts the server down and removes its directory
+func (s *Server) Stop() error {
+	out, err := exec.Command(s.pgCtl, "-D", filepath.Join(s.dir, "data"), "-m", "immediate", "-w", "stop").CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("dbxtest: pg_ctl stop: %w\n%s", err, out)
+	}
+	return errors.Join(err, os.RemoveAll(s.dir))
+}
+
+func (s *Server) logFile() string {
+	return filepath.Join(s.dir, "postgres.log")
+}
+
+// waitReady pings the server until it answers or timeout passes
+func (s *Server) waitReady(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		conn, err := pgx.ConnectConfig(ctx, s.config)
+		if err == nil {
+			err = conn.Ping(ctx)
+			conn.Close(ctx)
+			if err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log, _ := os.ReadFile(s.logFile())
+			return fmt.Errorf("dbxtest: server not ready: %w\n%s", err, log)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func (s *Server) migrate(ctx context.Context, fsys fs.FS) error {
+	conn, err := pgx.ConnectConfig(ctx, s.config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	m, err := migrate.New(conn, fsys)
+	if err != nil {
+		return err
+	}
+	return m.Up(ctx)
+}
+
+// Main starts a server for the tests of a package and points New and FreshDB at it. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		dbxtest.Main(m, &dbxtest.ServerOptions{Migrations: migrations, Template: "app_template"})
+//	}
+//
+// If a test database is already configured with DBX_TEST_DATABASE_URL, or PostgreSQL is not installed
+// or initdb cannot run, no server is started and the tests run as they would without Main.
+func Main(m *testing.M, opts *ServerOptions) {
+	if os.Getenv(EnvURL) != "" {
+		os.Exit(m.Run())
+	}
+
+	s, err := StartServer(context.Background(), opts)
+	if errors.Is(err, ErrNoPostgres) || errors.Is(err, ErrCannotInitdb) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(m.Run())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Setenv(EnvURL, s.ConnString)
+	if opts != nil && opts.Template != "" && opts.Migrations != nil {
+		os.Setenv(EnvTemplate, opts.Template)
+	}
+	code := m.Run()
+	if err := s.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
+// findBinDir returns the directory holding initdb and pg_ctl
+func findBinDir(binDir string) (string, error) {
+	if binDir != "" {
+		return binDir, nil
+	}
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), nil
+	}
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		dir := strings.TrimSpace(string(out))
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, nil
+		}
+	}
+	// Debian and Ubuntu keep the binaries out of PATH, one directory per major version
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Slice(dirs, func(i, j int) bool {
+		return majorVersion(dirs[i]) > majorVersion(dirs[j])
+	})
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", ErrNoPostgres
+}
+
+// majorVersion returns the version in /usr/lib/postgresql/<version>/bin
+func majorVersion(binDir string) int {
+	v, _ := strconv.Atoi(filepath.Base(filepath.Dir(binDir)))
+	return v
+}
+
+// freePort returns a TCP port that is free on 127.0.0.1
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
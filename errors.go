@@ -0,0 +1,99 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// MaxErrorSQLLen is the maximum length of the statement text kept in an Error
+var MaxErrorSQLLen = 200
+
+// Error describes a failed dbx operation together with the statement that caused it.
+// The underlying pgx error is reachable through errors.Is and errors.As.
+//
+// The %v and %s verbs print the argument count only; %+v also prints the argument values.
+type Error struct {
+	Op      string        // dbx operation, e.g. "select" or "insert"
+	SQL     string        // statement text, truncated to MaxErrorSQLLen
+	NumArgs int           // number of statement arguments
+	Args    []any         // statement arguments
+	Elapsed time.Duration // time spent before the error was observed
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dbx: %s: %v (sql=%q args=%d elapsed=%s)", e.Op, e.Err, e.SQL, e.NumArgs, e.Elapsed)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Format implements fmt.Formatter so that argument values are only printed on request
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		fmt.Fprintf(s, "dbx: %s: %v (sql=%q args=%v elapsed=%s)", e.Op, e.Err, e.SQL, e.Args, e.Elapsed)
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		fmt.Fprint(s, e.Error())
+	}
+}
+
+// SQLState returns the PostgreSQL error code, or "" if the error did not come from the server
+func (e *Error) SQLState() string {
+	var pgErr *pgconn.PgError
+	if errors.As(e.Err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// wrapErr wraps err with query context; errors that are already wrapped are returned as is
+func wrapErr(op, sql string, args []any, start time.Time, err error) error {
+	if err == nil {
+		return nil
+	}
+	var dbxErr *Error
+	if errors.As(err, &dbxErr) {
+		return err
+	}
+	return &Error{
+		Op:      op,
+		SQL:     truncateSQL(sql),
+		NumArgs: len(args),
+		Args:    args,
+		Elapsed: time.Since(start),
+		Err:     err,
+	}
+}
+
+// truncateSQL cuts sql to at most MaxErrorSQLLen bytes without splitting a UTF-8 character
+func truncateSQL(sql string) string {
+	if MaxErrorSQLLen > 0 && len(sql) > MaxErrorSQLLen {
+		n := MaxErrorSQLLen
+		for n > 0 && !utf8.RuneStart(sql[n]) {
+			n--
+		}
+		return sql[:n] + "..."
+	}
+	return sql
+}
+
+// row wraps a Row so that scan errors carry query context
+type row struct {
+	Row
+	op    string
+	sql   string
+	args  []any
+	start time.Time
+}
+
+func (r row) Scan(dest ...any) error {
+	return wrapErr(r.op, r.sql, r.args, r.start, r.Row.Scan(dest...))
+}
@@ -0,0 +1,99 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestTruncateSQL(t *testing.T) {
+	defer func(n int) { MaxErrorSQLLen = n }(MaxErrorSQLLen)
+
+	tests := []struct {
+		max  int
+		sql  string
+		want string
+	}{
+		{10, "SELECT 1", "SELECT 1"},
+		{8, "SELECT 1", "SELECT 1"},
+		{7, "SELECT 1", "SELECT ..."},
+		// "é" takes bytes 8 and 9 and must not be split
+		{9, "SELECT 'é'", "SELECT '..."},
+		{10, "SELECT 'é'", "SELECT 'é..."},
+		// "日" takes bytes 0 to 2
+		{1, "日本", "..."},
+		{2, "日本", "..."},
+		{3, "日本", "日..."},
+		{0, strings.Repeat("x", 500), strings.Repeat("x", 500)},
+		{-1, strings.Repeat("x", 500), strings.Repeat("x", 500)},
+	}
+	for _, tt := range tests {
+		MaxErrorSQLLen = tt.max
+		got := truncateSQL(tt.sql)
+		if got != tt.want {
+			t.Errorf("truncateSQL(%q) with MaxErrorSQLLen %d = %q, want %q", tt.sql, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateSQL(%q) with MaxErrorSQLLen %d = %q is not valid UTF-8", tt.sql, tt.max, got)
+		}
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	pgErr := &pgconn.PgError{Severity: "ERROR", Code: "23505", Message: "duplicate key"}
+	err := wrapErr("insert", "INSERT INTO users (email) VALUES ($1)", []any{"ada@example.com"}, time.Now(), pgErr)
+
+	for _, verb := range []string{"%v", "%s", "%q"} {
+		s := fmt.Sprintf(verb, err)
+		if strings.Contains(s, "ada@example.com") {
+			t.Errorf("%s shows the argument: %s", verb, s)
+		}
+		if !strings.Contains(s, "args=1") || !strings.Contains(s, "duplicate key") {
+			t.Errorf("%s = %s, want the argument count and the cause", verb, s)
+		}
+	}
+	if s := err.Error(); strings.Contains(s, "ada@example.com") {
+		t.Errorf("Error() shows the argument: %s", s)
+	}
+	if s := fmt.Sprintf("%+v", err); !strings.Contains(s, "args=[ada@example.com]") {
+		t.Errorf("%%+v = %s, want the argument values", s)
+	}
+	if s := fmt.Sprintf("%q", err); !strings.HasPrefix(s, `"dbx: insert: `) {
+		t.Errorf("%%q = %s, want a quoted message", s)
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "23505"}
+	err := fmt.Errorf("create user: %w", wrapErr("insert", "INSERT", nil, time.Now(), pgErr))
+
+	var target *pgconn.PgError
+	if !errors.As(err, &target) || target != pgErr {
+		t.Errorf("errors.As found %v, want the PgError", target)
+	}
+	var dbxErr *Error
+	if !errors.As(err, &dbxErr) || dbxErr.SQLState() != "23505" {
+		t.Errorf("errors.As to *Error: %v", dbxErr)
+	}
+
+	if again := wrapErr("select", "SELECT", nil, time.Now(), err); again != err {
+		t.Errorf("wrapped twice: %v", again)
+	}
+	if wrapErr("select", "SELECT", nil, time.Now(), nil) != nil {
+		t.Error("wrapped a nil error")
+	}
+
+	noRows := wrapErr("get", "SELECT", nil, time.Now(), pgx.ErrNoRows)
+	if !errors.Is(noRows, pgx.ErrNoRows) {
+		t.Error("errors.Is does not find pgx.ErrNoRows")
+	}
+	if state := noRows.(*Error).SQLState(); state != "" {
+		t.Errorf("SQLState of a client error = %q", state)
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE holdings (
+    ts TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    loc VARCHAR(50) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    amount NUMERIC(20,8) NOT NULL,
+    notes TEXT
+);
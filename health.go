@@ -0,0 +1,228 @@
+package dbx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HealthOptions configures StartHealthCheck
+type HealthOptions struct {
+	Interval   time.Duration // time between pings, default 5s
+	Timeout    time.Duration // timeout of a single ping or dial, default 2s
+	MinBackoff time.Duration // first delay between failed dials, default 100ms
+	MaxBackoff time.Duration // maximum delay between failed dials, default 30s
+
+	// AfterConnect, if set, runs on a re-dialed connection before it replaces the lost one,
+	// e.g. to register types again: a new connection does not have the types loaded with LoadType
+	// or registered in TypeMap. If it fails the connection is closed and dialing is retried.
+	AfterConnect func(ctx context.Context, c *pgx.Conn) error
+}
+
+var (
+	ready atomic.Bool
+
+	healthMu     sync.Mutex
+	healthCancel context.CancelFunc
+	healthDone   chan struct{}
+
+	reconnectCh = make(chan struct{}, 1)
+)
+
+// Ready reports whether the package-level connection is established and passed its last health check.
+// It turns false as soon as the connection is closed, e.g. by a statement that lost the server,
+// without waiting for the next check. A connection broken while idle is only noticed once used,
+// since the health check pings the server over a separate connection.
+func Ready() bool {
+	if !ready.Load() {
+		return false
+	}
+	c := current()
+	return c != nil && !c.IsClosed()
+}
+
+// ReadyHandler returns an http.Handler for readiness probes.
+// It responds 200 while Ready reports true and 503 otherwise.
+func ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// StartHealthCheck starts checking the package-level connection in the background.
+// The connection itself is never pinged, since it may be in use; instead the server is pinged
+// over a separate probe connection while the package-level connection is idle.
+// When the connection is closed it is re-dialed with the config of the last Connect,
+// backing off exponentially between attempts. The checker runs until ctx is done,
+// StopHealthCheck is called or the connection is closed with Close.
+func StartHealthCheck(ctx context.Context, opts *HealthOptions) {
+	var o HealthOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Interval <= 0 {
+		o.Interval = 5 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	o.MaxBackoff = max(o.MaxBackoff, o.MinBackoff)
+
+	StopHealthCheck()
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	healthMu.Lock()
+	healthCancel, healthDone = cancel, done
+	healthMu.Unlock()
+
+	go func() {
+		defer close(done)
+		healthLoop(ctx, o)
+	}()
+}
+
+// StopHealthCheck stops the health checker started by StartHealthCheck and waits for it to exit
+func StopHealthCheck() {
+	healthMu.Lock()
+	cancel, done := healthCancel, healthDone
+	healthCancel, healthDone = nil, nil
+	healthMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// requestReconnect wakes the health checker, if any, to re-dial immediately
+func requestReconnect() {
+	select {
+	case reconnectCh <- struct{}{}:
+	default:
+	}
+}
+
+func healthLoop(ctx context.Context, o HealthOptions) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	var probe *pgx.Conn
+	defer func() {
+		if probe != nil {
+			closeCtx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+			probe.Close(closeCtx)
+			cancel()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-reconnectCh:
+		}
+
+		connMu.RLock()
+		c := conn
+		connMu.RUnlock()
+		if c == nil || c.IsClosed() {
+			ready.Store(false)
+			redial(ctx, o)
+			continue
+		}
+		ready.Store(checkServer(ctx, &probe, o.Timeout))
+	}
+}
+
+// checkServer pings the server over the probe connection, dialing it if needed.
+// It reports the last state while the package-level connection is busy with a statement or transaction,
+// whose failure would close the connection and be noticed anyway.
+func checkServer(ctx context.Context, probe **pgx.Conn, timeout time.Duration) bool {
+	if inFlight, openTx := defaultMetrics.busy(); inFlight > 0 || openTx > 0 {
+		return ready.Load()
+	}
+	connMu.RLock()
+	config := connConfig
+	connMu.RUnlock()
+	if config == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if *probe == nil || (*probe).IsClosed() {
+		// the probe is not traced, so it does not show up in the metrics of the package-level connection
+		probeConfig := config.Copy()
+		probeConfig.Tracer = nil
+		c, err := pgx.ConnectConfig(ctx, probeConfig)
+		if err != nil {
+			return false
+		}
+		*probe = c
+	}
+	if err := (*probe).Ping(ctx); err != nil {
+		(*probe).Close(ctx)
+		*probe = nil
+		return false
+	}
+	return true
+}
+
+// redial replaces the closed package-level connection, retrying with exponential backoff until it succeeds or ctx is done
+func redial(ctx context.Context, o HealthOptions) {
+	connMu.RLock()
+	config := connConfig
+	connMu.RUnlock()
+	if config == nil {
+		return
+	}
+
+	backoff := o.MinBackoff
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, o.Timeout)
+		c, err := pgx.ConnectConfig(dialCtx, config)
+		if err == nil && o.AfterConnect != nil {
+			if err = o.AfterConnect(dialCtx, c); err != nil {
+				c.Close(dialCtx)
+			}
+		}
+		cancel()
+		if err == nil {
+			connMu.Lock()
+			old := conn
+			conn = c
+			connMu.Unlock()
+			if old != nil {
+				// old is closed already, this only releases its resources
+				closeCtx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+				old.Close(closeCtx)
+				cancel()
+			}
+			ready.Store(true)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, o.MaxBackoff)
+	}
+}
@@ -0,0 +1,69 @@
+package dbx
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// fakeServer accepts one connection, completes the startup handshake and returns the server side
+func fakeServer(t *testing.T) (addr string, accepted <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		backend := pgproto3.NewBackend(c, c)
+		if _, err := backend.ReceiveStartupMessage(); err != nil {
+			c.Close()
+			return
+		}
+		backend.Send(&pgproto3.AuthenticationOk{})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if err := backend.Flush(); err != nil {
+			c.Close()
+			return
+		}
+		ch <- c
+	}()
+	return ln.Addr().String(), ch
+}
+
+// TestReadyLostConnection drops the server side of the package-level connection. Ready must turn
+// false once a statement finds the connection broken, not only at the next health check.
+func TestReadyLostConnection(t *testing.T) {
+	ctx := context.Background()
+	addr, accepted := fakeServer(t)
+	config, err := pgx.ParseConfig("postgres://u@" + addr + "/app?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ConnectConfig(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close(ctx) })
+
+	server := <-accepted
+	if !Ready() {
+		t.Fatal("not ready after connecting")
+	}
+	server.Close()
+
+	if _, err := Exec(ctx, "SELECT 1"); err == nil {
+		t.Fatal("Exec succeeded without a server")
+	}
+	if Ready() {
+		t.Error("ready after a statement lost the connection")
+	}
+}
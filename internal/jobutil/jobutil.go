@@ -0,0 +1,140 @@
+// Package jobutil holds the pieces shared by the outbox relay and the queue workers
+package jobutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+)
+
+// Backoff returns the delay before retrying after attempt failures: minDelay doubled for every failure
+// after the first, capped at maxDelay
+func Backoff(attempt int, minDelay, maxDelay time.Duration) time.Duration {
+	d := minDelay
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxDelay)
+}
+
+// MarshalJSON returns v as JSON for a jsonb column. []byte and json.RawMessage must already be JSON
+// and are returned as is.
+func MarshalJSON(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	}
+	return json.Marshal(v)
+}
+
+// Waker wakes a polling loop when a notification arrives, so it does not wait for its next poll
+type Waker struct {
+	C <-chan struct{} // receives a value after notifications and Signal calls; several of them may be merged
+
+	c      chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the listening goroutine returned
+}
+
+// NewWaker returns a Waker that is only woken by Signal
+func NewWaker() *Waker {
+	c := make(chan struct{}, 1)
+	return &Waker{C: c, c: c}
+}
+
+// Listen returns a Waker listening on channel until ctx is done or Close is called.
+// It connects with config, or with the config of the package-level connection if config is nil.
+// When the connection is lost, onError is called if not nil and the Waker connects and listens again,
+// backing off between attempts; it signals once reconnected, since notifications may have been missed.
+func Listen(ctx context.Context, config *pgx.ConnConfig, channel string, onError func(error)) (*Waker, error) {
+	dial := func(ctx context.Context) (*dbx.Listener, error) {
+		if config != nil {
+			return dbx.NewListener(ctx, config, channel)
+		}
+		return dbx.Listen(ctx, channel)
+	}
+	l, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w := NewWaker()
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	report := func(err error) {
+		if onError != nil {
+			onError(fmt.Errorf("listen on %s: %w", channel, err))
+		}
+	}
+	go func() {
+		defer close(w.done)
+		for {
+			err := w.wait(ctx, l)
+			l.Close(context.Background())
+			// the listener is closed on ctx being done, Close and dbx.Shutdown
+			if ctx.Err() != nil || errors.Is(err, dbx.ErrListenerClosed) {
+				return
+			}
+			report(err)
+			if l = redial(ctx, dial, report); l == nil {
+				return
+			}
+			w.Signal()
+		}
+	}()
+	return w, nil
+}
+
+// wait signals w for every notification on l until Wait fails
+func (w *Waker) wait(ctx context.Context, l *dbx.Listener) error {
+	for {
+		if _, err := l.Wait(ctx); err != nil {
+			return err
+		}
+		w.Signal()
+	}
+}
+
+// redial connects with dial until it succeeds, backing off between attempts, or returns nil once ctx is done
+func redial(ctx context.Context, dial func(context.Context) (*dbx.Listener, error), report func(error)) *dbx.Listener {
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(Backoff(attempt, 100*time.Millisecond, 30*time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		l, err := dial(ctx)
+		if err == nil {
+			return l
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		report(err)
+	}
+}
+
+// Signal wakes the loop as a notification would
+func (w *Waker) Signal() {
+	select {
+	case w.c <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops listening and waits for the connection to be closed
+func (w *Waker) Close() {
+	if w.cancel != nil {
+		w.cancel()
+		<-w.done
+	}
+}
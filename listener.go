@@ -0,0 +1,100 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Notification is a message received by a Listener
+type Notification = pgconn.Notification
+
+// ErrListenerClosed is returned by Listener.Wait after the listener was closed
+var ErrListenerClosed = errors.New("dbx: listener closed")
+
+// Listener receives LISTEN/NOTIFY notifications on a dedicated connection,
+// so that waiting for notifications does not block other statements
+type Listener struct {
+	conn   *pgx.Conn
+	ctx    context.Context // canceled by Close to interrupt Wait
+	cancel context.CancelFunc
+
+	mu     sync.Mutex // held while waiting
+	closed bool
+}
+
+var (
+	listenersMu sync.Mutex
+	listeners   = make(map[*Listener]struct{})
+)
+
+// Listen opens a dedicated connection with the config of the package-level connection and listens on channels
+func Listen(ctx context.Context, channels ...string) (*Listener, error) {
+	connMu.RLock()
+	config := connConfig
+	connMu.RUnlock()
+	if config == nil {
+		return nil, errors.New("dbx: not connected")
+	}
+	return NewListener(ctx, config, channels...)
+}
+
+// NewListener opens a connection with config and listens on channels.
+// Listeners are stopped by Shutdown.
+func NewListener(ctx context.Context, config *pgx.ConnConfig, channels ...string) (*Listener, error) {
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			conn.Close(ctx)
+			return nil, err
+		}
+	}
+
+	l := &Listener{conn: conn}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	listenersMu.Lock()
+	listeners[l] = struct{}{}
+	listenersMu.Unlock()
+	return l, nil
+}
+
+// Wait blocks until a notification arrives, ctx is done or the listener is closed
+func (l *Listener) Wait(ctx context.Context) (*Notification, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(l.ctx, cancel)
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrListenerClosed
+	}
+	n, err := l.conn.WaitForNotification(ctx)
+	if err != nil && l.ctx.Err() != nil {
+		return nil, ErrListenerClosed
+	}
+	return n, err
+}
+
+// Close interrupts Wait and closes the connection
+func (l *Listener) Close(ctx context.Context) error {
+	l.cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	listenersMu.Lock()
+	delete(listeners, l)
+	listenersMu.Unlock()
+	return l.conn.Close(ctx)
+}
@@ -0,0 +1,423 @@
+// Package migrate applies versioned SQL and Go migrations.
+//
+// SQL migrations are read from an fs.FS, typically an embed.FS, as pairs of files named
+// NNNN_name.up.sql and NNNN_name.down.sql; the down file is optional. Go migrations are added
+// with Register and RegisterNoTx. Applied versions are recorded with a checksum in the
+// schema_migrations table, and a PostgreSQL advisory lock keeps concurrent deploys from
+// applying migrations at the same time.
+//
+// An up file starting with "-- dbx:no-transaction" runs outside a transaction in both
+// directions, one statement at a time. Its statements are split at semicolons outside quotes,
+// comments and dollar-quoted strings, so BEGIN ATOMIC function bodies need a transactional
+// migration. If a statement fails, the ones before it stay applied: such files should hold a
+// single statement or use IF NOT EXISTS and the like to be safe to rerun.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+)
+
+// ErrNoDown is returned when reverting a migration that has no down file
+var ErrNoDown = errors.New("migrate: no down migration")
+
+// Func is a Go migration step, run inside its own transaction
+type Func func(ctx context.Context, tx dbx.Tx) error
+
+// NoTxFunc is a Go migration step run outside a transaction, e.g. for CREATE INDEX CONCURRENTLY
+type NoTxFunc func(ctx context.Context, conn *pgx.Conn) error
+
+// Migration is a single versioned schema change, either SQL or Go
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string // hex SHA-256 of UpSQL, empty for Go migrations
+	NoTx     bool   // run outside a transaction
+
+	UpFunc, DownFunc Func
+	UpNoTx, DownNoTx NoTxFunc
+}
+
+// noTxDirective on the first line of an up file makes the migration run outside a transaction
+const noTxDirective = "-- dbx:no-transaction"
+
+func (mig *Migration) hasDown() bool {
+	return mig.DownSQL != "" || mig.DownFunc != nil || mig.DownNoTx != nil
+}
+
+// Status is the state of one migration
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Checksum  string // checksum recorded when the migration was applied
+}
+
+// Option configures a Migrator
+type Option func(*Migrator)
+
+// WithTable sets the table that records applied migrations, default schema_migrations.
+// The name may be schema-qualified.
+func WithTable(name string) Option {
+	return func(m *Migrator) {
+		m.table = name
+	}
+}
+
+// WithLockID sets the advisory lock key, by default derived from the table name
+func WithLockID(id int64) Option {
+	return func(m *Migrator) {
+		m.lockID = id
+	}
+}
+
+// Migrator applies migrations on a single connection
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []*Migration // sorted by version
+	table      string
+	lockID     int64
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// New reads the migrations in the root directory of fsys. Use fs.Sub for a subdirectory.
+func New(conn *pgx.Conn, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	m := &Migrator{conn: conn, table: "schema_migrations"}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.lockID == 0 {
+		h := fnv.New64a()
+		h.Write([]byte("dbx/migrate:" + m.table))
+		m.lockID = int64(h.Sum64())
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by both %q and %q", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.UpSQL = string(b)
+			mig.Checksum = checksum(b)
+			mig.NoTx = strings.HasPrefix(strings.TrimSpace(mig.UpSQL), noTxDirective)
+		} else {
+			mig.DownSQL = string(b)
+		}
+	}
+
+	for _, mig := range byVersion {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", mig.Version)
+		}
+		m.migrations = append(m.migrations, mig)
+	}
+	m.sort()
+	return m, nil
+}
+
+// Register adds a Go migration whose steps each run in their own transaction.
+// Go migrations are interleaved with SQL migrations by version; down may be nil.
+func (m *Migrator) Register(version int64, name string, up, down Func) error {
+	return m.add(&Migration{Version: version, Name: name, UpFunc: up, DownFunc: down})
+}
+
+// RegisterNoTx adds a Go migration whose steps run outside a transaction
+func (m *Migrator) RegisterNoTx(version int64, name string, up, down NoTxFunc) error {
+	return m.add(&Migration{Version: version, Name: name, NoTx: true, UpNoTx: up, DownNoTx: down})
+}
+
+func (m *Migrator) add(mig *Migration) error {
+	if existing := m.find(mig.Version); existing != nil {
+		return fmt.Errorf("migrate: version %d is used by both %q and %q", mig.Version, existing.Name, mig.Name)
+	}
+	m.migrations = append(m.migrations, mig)
+	m.sort()
+	return nil
+}
+
+func (m *Migrator) sort() {
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrations returns the migrations read from the file system, in version order
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		return m.up(ctx, -1)
+	})
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		versions := appliedVersions(applied)
+		for i := 0; i < steps && i < len(versions); i++ {
+			if err := m.down(ctx, versions[len(versions)-1-i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// To migrates up or down so that exactly the migrations up to and including version are applied
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		versions := appliedVersions(applied)
+		for i := len(versions) - 1; i >= 0 && versions[i] > version; i-- {
+			if err := m.down(ctx, versions[i]); err != nil {
+				return err
+			}
+		}
+		return m.up(ctx, version)
+	})
+}
+
+// Status returns the state of every known or applied migration, in version order.
+// It does not create the migrations table; a missing one means nothing is applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s = a
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range applied {
+		if m.find(version) == nil {
+			statuses = append(statuses, a)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// locked runs fn while holding the advisory lock
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", m.lockID); err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+	defer m.conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", m.lockID)
+
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+m.ident()+` (
+	version bigint PRIMARY KEY,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return fmt.Errorf("migrate: create %s: %w", m.table, err)
+	}
+	return nil
+}
+
+func (m *Migrator) ident() string {
+	return pgx.Identifier(strings.Split(m.table, ".")).Sanitize()
+}
+
+// applied returns the recorded migrations by version, or none if the migrations table does not exist
+func (m *Migrator) applied(ctx context.Context) (map[int64]Status, error) {
+	applied := make(map[int64]Status)
+	var exists bool
+	if err := m.conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", m.ident()).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := m.conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM "+m.ident())
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	for rows.Next() {
+		s := Status{Applied: true}
+		if err := rows.Scan(&s.Version, &s.Name, &s.Checksum, &s.AppliedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return applied, nil
+}
+
+func appliedVersions(applied map[int64]Status) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return nil
+}
+
+// up applies pending migrations up to and including target, or all of them if target is negative
+func (m *Migrator) up(ctx context.Context, target int64) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if target >= 0 && mig.Version > target {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, mig, true); err != nil {
+			return fmt.Errorf("migrate: up %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// down reverts the applied migration with version
+func (m *Migrator) down(ctx context.Context, version int64) error {
+	mig := m.find(version)
+	if mig == nil || !mig.hasDown() {
+		return fmt.Errorf("%w for version %d", ErrNoDown, version)
+	}
+	if err := m.apply(ctx, mig, false); err != nil {
+		return fmt.Errorf("migrate: down %d_%s: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+// apply runs the up or down step of mig and records the result in the migrations table
+func (m *Migrator) apply(ctx context.Context, mig *Migration, up bool) error {
+	sql, fn, noTxFn := mig.UpSQL, mig.UpFunc, mig.UpNoTx
+	if !up {
+		sql, fn, noTxFn = mig.DownSQL, mig.DownFunc, mig.DownNoTx
+	}
+	record := func(q dbx.Querier) error {
+		var err error
+		if up {
+			_, err = q.Exec(ctx, "INSERT INTO "+m.ident()+" (version, name, checksum) VALUES ($1, $2, $3)",
+				mig.Version, mig.Name, mig.Checksum)
+		} else {
+			_, err = q.Exec(ctx, "DELETE FROM "+m.ident()+" WHERE version = $1", mig.Version)
+		}
+		return err
+	}
+
+	if mig.NoTx {
+		var err error
+		if noTxFn != nil {
+			err = noTxFn(ctx, m.conn)
+		} else {
+			// sent together, the statements would run in one implicit transaction
+			for i, stmt := range splitStatements(sql) {
+				if _, err = m.conn.Exec(ctx, stmt); err != nil {
+					err = fmt.Errorf("statement %d: %w", i+1, err)
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return record(m.conn)
+	}
+
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		err = fn(ctx, tx)
+	} else {
+		_, err = tx.Exec(ctx, sql)
+	}
+	if err == nil {
+		err = record(tx)
+	}
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
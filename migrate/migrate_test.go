@@ -0,0 +1,204 @@
+package migrate
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/xtdlib/dbx"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":      file("-- dbx:no-transaction\nCREATE INDEX CONCURRENTLY i ON t (a);"),
+		"0002_add_index.down.sql":    file("DROP INDEX CONCURRENTLY i;"),
+		"0001_create_table.up.sql":   file("CREATE TABLE t (a int);"),
+		"0001_create_table.down.sql": file("DROP TABLE t;"),
+		"10_seed.up.sql":             file("INSERT INTO t VALUES (1);\n-- dbx:no-transaction is only a directive on the first line"),
+		"README.md":                  file("not a migration"),
+		"0003_notes.sql":             file("no direction"),
+		"0004_dir.up.sql/x":          file("a directory"),
+	}
+	m, err := New(nil, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		version int64
+		name    string
+		noTx    bool
+		hasDown bool
+	}{
+		{1, "create_table", false, true},
+		{2, "add_index", true, true},
+		{10, "seed", false, false},
+	}
+	migs := m.Migrations()
+	if len(migs) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(migs), len(want))
+	}
+	for i, w := range want {
+		mig := migs[i]
+		if mig.Version != w.version || mig.Name != w.name || mig.NoTx != w.noTx || mig.hasDown() != w.hasDown {
+			t.Errorf("migration %d = %d_%s noTx %v down %v, want %d_%s noTx %v down %v",
+				i, mig.Version, mig.Name, mig.NoTx, mig.hasDown(), w.version, w.name, w.noTx, w.hasDown)
+		}
+		if mig.Checksum != checksum([]byte(mig.UpSQL)) {
+			t.Errorf("%d_%s: checksum %s does not match the up file", mig.Version, mig.Name, mig.Checksum)
+		}
+	}
+	if migs[0].UpSQL != "CREATE TABLE t (a int);" || migs[0].DownSQL != "DROP TABLE t;" {
+		t.Errorf("SQL = %q / %q", migs[0].UpSQL, migs[0].DownSQL)
+	}
+	// the checksum covers the up file only
+	if migs[0].Checksum == migs[1].Checksum {
+		t.Error("different up files have the same checksum")
+	}
+}
+
+func TestNewChecksum(t *testing.T) {
+	a, err := New(nil, fstest.MapFS{"1_a.up.sql": file("SELECT 1;"), "1_a.down.sql": file("SELECT 2;")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(nil, fstest.MapFS{"1_a.up.sql": file("SELECT 1;"), "1_a.down.sql": file("SELECT 3;")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(nil, fstest.MapFS{"1_a.up.sql": file("SELECT 1; ")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Migrations()[0].Checksum != b.Migrations()[0].Checksum {
+		t.Error("changing the down file changed the checksum")
+	}
+	if a.Migrations()[0].Checksum == c.Migrations()[0].Checksum {
+		t.Error("changing the up file kept the checksum")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"0001_a.up.sql": file("SELECT 1;"),
+				"1_b.up.sql":    file("SELECT 2;"),
+			},
+			wantErr: "version 1 is used by both",
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{
+				"0001_a.up.sql":   file("SELECT 1;"),
+				"0002_b.down.sql": file("SELECT 2;"),
+			},
+			wantErr: "version 2 has no up migration",
+		},
+		{
+			name:    "version out of range",
+			fsys:    fstest.MapFS{"99999999999999999999_a.up.sql": file("SELECT 1;")},
+			wantErr: "value out of range",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(nil, tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	m, err := New(nil, fstest.MapFS{"0001_a.up.sql": file("SELECT 1;"), "0003_c.up.sql": file("SELECT 3;")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noop := func(context.Context, dbx.Tx) error { return nil }
+	if err := m.Register(2, "b", noop, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register(3, "other", noop, nil); err == nil || !strings.Contains(err.Error(), "version 3 is used by both") {
+		t.Errorf("err = %v, want a duplicate version", err)
+	}
+
+	var versions []int64
+	for _, mig := range m.Migrations() {
+		versions = append(versions, mig.Version)
+	}
+	if len(versions) != 3 || versions[0] != 1 || versions[1] != 2 || versions[2] != 3 {
+		t.Errorf("versions = %v, want [1 2 3]", versions)
+	}
+	if mig := m.Migrations()[1]; mig.Checksum != "" || mig.hasDown() {
+		t.Errorf("Go migration has checksum %q, down %v", mig.Checksum, mig.hasDown())
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "no-transaction file",
+			sql:  "-- dbx:no-transaction\nCREATE INDEX CONCURRENTLY a ON t (a);\nCREATE INDEX CONCURRENTLY b ON t (b);\n",
+			want: []string{"-- dbx:no-transaction\nCREATE INDEX CONCURRENTLY a ON t (a)", "CREATE INDEX CONCURRENTLY b ON t (b)"},
+		},
+		{
+			name: "no trailing semicolon",
+			sql:  "SELECT 1; SELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "empty statements and comments",
+			sql:  ";; SELECT 1;\n-- done; really\n/* the end; */\n",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "quotes",
+			sql:  `SELECT 'a;''b', E'c\';', "d;""e" FROM t; SELECT 2`,
+			want: []string{`SELECT 'a;''b', E'c\';', "d;""e" FROM t`, "SELECT 2"},
+		},
+		{
+			name: "backslash outside an escape string",
+			sql:  `SELECT 'a\'; SELECT 2`,
+			want: []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name: "comments",
+			sql:  "SELECT 1 -- a; b\n, /* c; /* nested; */ d; */ 2; SELECT 3",
+			want: []string{"SELECT 1 -- a; b\n, /* c; /* nested; */ d; */ 2", "SELECT 3"},
+		},
+		{
+			name: "dollar quotes",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; DO $body$ BEGIN PERFORM $x$;$x$; END $body$;",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "DO $body$ BEGIN PERFORM $x$;$x$; END $body$"},
+		},
+		{
+			name: "parameters and identifiers with dollars",
+			sql:  "PREPARE p AS SELECT $1; SELECT a$b$c FROM t; SELECT 2",
+			want: []string{"PREPARE p AS SELECT $1", "SELECT a$b$c FROM t", "SELECT 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
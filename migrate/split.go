@@ -0,0 +1,116 @@
+package migrate
+
+import "strings"
+
+// splitStatements splits sql into statements at semicolons outside quotes, comments and
+// dollar-quoted strings. Pieces holding nothing but comments and white space are dropped.
+func splitStatements(sql string) []string {
+	var stmts []string
+	start, code := 0, false
+	flush := func(end int) {
+		if code {
+			stmts = append(stmts, strings.TrimSpace(sql[start:end]))
+		}
+		start, code = end+1, false
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ';':
+			flush(i)
+			continue
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if n := strings.IndexByte(sql[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(sql)
+			}
+			continue
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			continue
+		}
+
+		code = true
+		switch {
+		case c == '\'':
+			backslash := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentByte(sql[i-2]))
+			i = skipQuoted(sql, i, '\'', backslash)
+		case c == '"':
+			i = skipQuoted(sql, i, '"', false)
+		case c == '$' && (i == 0 || !isIdentByte(sql[i-1])):
+			if tag := dollarTag(sql[i:]); tag != "" {
+				if n := strings.Index(sql[i+len(tag):], tag); n >= 0 {
+					i += len(tag) + n + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		}
+	}
+	flush(len(sql))
+	return stmts
+}
+
+// skipQuoted returns the index of the quote closing the string opened at sql[i].
+// A doubled quote is part of the string, and so is a quote after a backslash if backslash is set.
+func skipQuoted(sql string, i int, quote byte, backslash bool) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case backslash && sql[i] == '\\':
+			i++
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index of the last byte of the block comment opened at sql[i],
+// which may be nested
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for ; i < len(sql); i++ {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the dollar quote tag, e.g. "$body$" or "$$", that s starts with, if any
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c >= '0' && c <= '9':
+			if i == 1 {
+				return "" // a parameter such as $1
+			}
+		case !isIdentByte(c):
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Drift is a single finding of Verify
+type Drift struct {
+	Version         int64
+	Name            string
+	AppliedChecksum string // checksum recorded in the migrations table
+	Checksum        string // checksum of the migration on disk
+}
+
+// Report is the result of Verify
+type Report struct {
+	Modified   []Drift // applied migrations whose file changed after they were applied
+	Missing    []Drift // applied migrations that no longer exist
+	OutOfOrder []Drift // pending migrations older than the newest applied one, which Up would apply out of order
+	Pending    []Drift // migrations not applied yet, including OutOfOrder ones
+}
+
+// OK reports whether the applied migrations match the migrations on disk.
+// Pending migrations alone do not make a report fail.
+func (r *Report) OK() bool {
+	return len(r.Modified) == 0 && len(r.Missing) == 0 && len(r.OutOfOrder) == 0
+}
+
+// Err returns an error listing every problem, or nil if the report is OK
+func (r *Report) Err() error {
+	if r.OK() {
+		return nil
+	}
+	var problems []string
+	for _, d := range r.Modified {
+		problems = append(problems, fmt.Sprintf("%d_%s was modified after it was applied", d.Version, d.Name))
+	}
+	for _, d := range r.Missing {
+		problems = append(problems, fmt.Sprintf("%d_%s is applied but missing", d.Version, d.Name))
+	}
+	for _, d := range r.OutOfOrder {
+		problems = append(problems, fmt.Sprintf("%d_%s is pending but older than the last applied migration", d.Version, d.Name))
+	}
+	return fmt.Errorf("migrate: schema drift: %s", strings.Join(problems, "; "))
+}
+
+// Verify reads the migrations in fsys and compares them with the ones applied on conn.
+// Go migrations are not known to it, so applied versions recorded without a checksum are
+// not reported as missing; use Migrator.Verify after registering them to check those too.
+func Verify(ctx context.Context, conn *pgx.Conn, fsys fs.FS, opts ...Option) (*Report, error) {
+	m, err := New(conn, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	report, err := m.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Missing = slices.DeleteFunc(report.Missing, func(d Drift) bool {
+		return d.AppliedChecksum == ""
+	})
+	return report, nil
+}
+
+// Verify compares the applied migrations with the known ones. Go migrations have no
+// checksum, so only their presence is checked. It only reads the migrations table and
+// treats a missing one as nothing applied.
+func (m *Migrator) Verify(ctx context.Context) (*Report, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxApplied int64 = -1
+	for _, s := range statuses {
+		if s.Applied {
+			maxApplied = max(maxApplied, s.Version)
+		}
+	}
+
+	report := &Report{}
+	for _, s := range statuses {
+		mig := m.find(s.Version)
+		d := Drift{Version: s.Version, Name: s.Name, AppliedChecksum: s.Checksum}
+		if mig != nil {
+			d.Name, d.Checksum = mig.Name, mig.Checksum
+		}
+		switch {
+		case mig == nil:
+			report.Missing = append(report.Missing, d)
+		case !s.Applied:
+			report.Pending = append(report.Pending, d)
+			if s.Version < maxApplied {
+				report.OutOfOrder = append(report.OutOfOrder, d)
+			}
+		case s.Checksum != mig.Checksum || s.Name != mig.Name:
+			report.Modified = append(report.Modified, d)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,171 @@
+// Package otelx exports dbx statements as OpenTelemetry spans and metrics.
+//
+// The package does not depend on OpenTelemetry. Tracer, Span, Meter and Histogram
+// mirror the small part of the OpenTelemetry API that is needed, so connecting an
+// SDK takes a thin adapter. Recorder implements them in memory for tests.
+package otelx
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+)
+
+// Attribute is a key/value pair attached to spans and measurements
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 returns an integer attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// StatusCode mirrors the OpenTelemetry span status codes
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusError
+	StatusOK
+)
+
+// Tracer starts spans
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single traced operation
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	SetStatus(code StatusCode, description string)
+	End()
+}
+
+// Meter creates histograms
+type Meter interface {
+	Histogram(name, unit, description string) Histogram
+}
+
+// Histogram records a distribution of values
+type Histogram interface {
+	Record(ctx context.Context, value float64, attrs ...Attribute)
+}
+
+// Metric names, following the OpenTelemetry database semantic conventions
+const (
+	MetricOperationDuration = "db.client.operation.duration"
+	MetricConnectionWait    = "db.client.connection.wait_time"
+)
+
+// Config configures a Hook. Tracer and Meter may each be nil to disable spans or metrics.
+type Config struct {
+	Tracer Tracer
+	Meter  Meter
+	DBName string // reported as db.name when set
+}
+
+// Hook is a dbx.Hook that emits a span and a duration measurement per statement
+type Hook struct {
+	cfg      Config
+	duration Histogram
+	wait     Histogram
+}
+
+// NewHook returns a hook for use with dbx.WithHooks or dbx.NewTracer
+func NewHook(cfg Config) *Hook {
+	h := &Hook{cfg: cfg}
+	if cfg.Meter != nil {
+		h.duration = cfg.Meter.Histogram(MetricOperationDuration, "s", "Duration of database client operations")
+		h.wait = cfg.Meter.Histogram(MetricConnectionWait, "s", "Time it took to obtain a connection from the pool")
+	}
+	return h
+}
+
+type spanKey struct{}
+
+// Before implements dbx.Hook
+func (h *Hook) Before(ctx context.Context, e *dbx.Event) context.Context {
+	if h.cfg.Tracer == nil || e.Op == "acquire" {
+		return ctx
+	}
+	op := operation(e)
+	name := op
+	if h.cfg.DBName != "" {
+		name += " " + h.cfg.DBName
+	}
+	ctx, span := h.cfg.Tracer.Start(ctx, name, h.attributes(e, op)...)
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// After implements dbx.Hook
+func (h *Hook) After(ctx context.Context, e *dbx.Event) {
+	if e.Op == "acquire" {
+		if h.wait != nil {
+			h.wait.Record(ctx, e.Duration.Seconds(), h.baseAttributes()...)
+		}
+		return
+	}
+
+	op := operation(e)
+	if h.duration != nil {
+		attrs := append(h.baseAttributes(), String("db.operation", op))
+		if e.Err != nil {
+			attrs = append(attrs, String("error.type", errorType(e.Err)))
+		}
+		h.duration.Record(ctx, e.Duration.Seconds(), attrs...)
+	}
+
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(Int64("db.rows_affected", e.RowsAffected))
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(StatusError, e.Err.Error())
+	}
+	span.End()
+}
+
+func (h *Hook) baseAttributes() []Attribute {
+	attrs := []Attribute{String("db.system", "postgresql")}
+	if h.cfg.DBName != "" {
+		attrs = append(attrs, String("db.name", h.cfg.DBName))
+	}
+	return attrs
+}
+
+func (h *Hook) attributes(e *dbx.Event, op string) []Attribute {
+	return append(h.baseAttributes(),
+		String("db.statement", e.SQL),
+		String("db.operation", op),
+	)
+}
+
+// operation returns the SQL verb of the statement, e.g. SELECT
+func operation(e *dbx.Event) string {
+	if fields := strings.Fields(e.SQL); len(fields) > 0 && e.Op != "batch" {
+		return strings.ToUpper(fields[0])
+	}
+	return strings.ToUpper(e.Op)
+}
+
+// errorType returns the SQLSTATE of err, or "_OTHER" if it did not come from the server
+func errorType(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return "_OTHER"
+}
@@ -0,0 +1,193 @@
+package otelx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/otelx"
+)
+
+// send passes e through the hook as the dbx tracer does
+func send(h *otelx.Hook, e *dbx.Event) {
+	ctx := h.Before(context.Background(), e)
+	h.After(ctx, e)
+}
+
+func TestHookSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbName     string
+		event      dbx.Event
+		wantName   string
+		wantOp     string
+		wantStatus otelx.StatusCode
+	}{
+		{
+			name:     "select",
+			event:    dbx.Event{Op: "query", SQL: "select * from holdings where loc = $1", RowsAffected: 3},
+			wantName: "SELECT",
+			wantOp:   "SELECT",
+		},
+		{
+			name:     "db name",
+			dbName:   "app",
+			event:    dbx.Event{Op: "exec", SQL: "  UPDATE holdings SET amount = 0"},
+			wantName: "UPDATE app",
+			wantOp:   "UPDATE",
+		},
+		{
+			name:     "batch",
+			event:    dbx.Event{Op: "batch", SQL: "INSERT INTO a VALUES (1); INSERT INTO b VALUES (2)"},
+			wantName: "BATCH",
+			wantOp:   "BATCH",
+		},
+		{
+			name:     "no statement",
+			event:    dbx.Event{Op: "commit"},
+			wantName: "COMMIT",
+			wantOp:   "COMMIT",
+		},
+		{
+			name:       "error",
+			event:      dbx.Event{Op: "exec", SQL: "DELETE FROM holdings", Err: errors.New("conn closed")},
+			wantName:   "DELETE",
+			wantOp:     "DELETE",
+			wantStatus: otelx.StatusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := otelx.NewRecorder()
+			send(otelx.NewHook(otelx.Config{Tracer: rec, DBName: tt.dbName}), &tt.event)
+
+			spans := rec.Spans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			s := spans[0]
+			if s.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", s.Name, tt.wantName)
+			}
+			if s.End.IsZero() {
+				t.Error("span did not end")
+			}
+			want := map[string]any{
+				"db.system":        "postgresql",
+				"db.statement":     tt.event.SQL,
+				"db.operation":     tt.wantOp,
+				"db.rows_affected": tt.event.RowsAffected,
+			}
+			if tt.dbName != "" {
+				want["db.name"] = tt.dbName
+			}
+			for k, v := range want {
+				if s.Attributes[k] != v {
+					t.Errorf("attribute %s = %v, want %v", k, s.Attributes[k], v)
+				}
+			}
+			if len(s.Attributes) != len(want) {
+				t.Errorf("attributes = %v, want %v", s.Attributes, want)
+			}
+			if s.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", s.Status, tt.wantStatus)
+			}
+			if tt.event.Err != nil {
+				if len(s.Errors) != 1 || s.Errors[0] != tt.event.Err {
+					t.Errorf("errors = %v, want [%v]", s.Errors, tt.event.Err)
+				}
+				if s.Description != tt.event.Err.Error() {
+					t.Errorf("description = %q, want %q", s.Description, tt.event.Err.Error())
+				}
+			} else if len(s.Errors) != 0 {
+				t.Errorf("errors = %v, want none", s.Errors)
+			}
+		})
+	}
+}
+
+func TestHookDuration(t *testing.T) {
+	tests := []struct {
+		name          string
+		event         dbx.Event
+		wantErrorType string // empty for no error.type attribute
+	}{
+		{
+			name:  "success",
+			event: dbx.Event{Op: "query", SQL: "SELECT 1", Duration: 1500 * time.Millisecond},
+		},
+		{
+			name:          "server error",
+			event:         dbx.Event{Op: "exec", SQL: "INSERT INTO t VALUES (1)", Duration: time.Millisecond, Err: &pgconn.PgError{Code: "23505"}},
+			wantErrorType: "23505",
+		},
+		{
+			name:          "client error",
+			event:         dbx.Event{Op: "exec", SQL: "INSERT INTO t VALUES (1)", Duration: time.Millisecond, Err: errors.New("conn closed")},
+			wantErrorType: "_OTHER",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := otelx.NewRecorder()
+			send(otelx.NewHook(otelx.Config{Meter: rec, DBName: "app"}), &tt.event)
+
+			if spans := rec.Spans(); len(spans) != 0 {
+				t.Errorf("got %d spans without a tracer", len(spans))
+			}
+			ms := rec.Measurements(otelx.MetricOperationDuration)
+			if len(ms) != 1 {
+				t.Fatalf("got %d measurements, want 1", len(ms))
+			}
+			m := ms[0]
+			if m.Value != tt.event.Duration.Seconds() {
+				t.Errorf("value = %v, want %v", m.Value, tt.event.Duration.Seconds())
+			}
+			if m.Attributes["db.system"] != "postgresql" || m.Attributes["db.name"] != "app" {
+				t.Errorf("attributes = %v, want db.system and db.name", m.Attributes)
+			}
+			if _, ok := m.Attributes["db.statement"]; ok {
+				t.Error("measurement has db.statement, which has unbounded cardinality")
+			}
+			if got, _ := m.Attributes["error.type"].(string); got != tt.wantErrorType {
+				t.Errorf("error.type = %q, want %q", got, tt.wantErrorType)
+			}
+			if ws := rec.Measurements(otelx.MetricConnectionWait); len(ws) != 0 {
+				t.Errorf("got %d wait measurements for a statement", len(ws))
+			}
+		})
+	}
+}
+
+func TestHookAcquire(t *testing.T) {
+	rec := otelx.NewRecorder()
+	h := otelx.NewHook(otelx.Config{Tracer: rec, Meter: rec})
+	send(h, &dbx.Event{Op: "acquire", Duration: 20 * time.Millisecond})
+
+	if spans := rec.Spans(); len(spans) != 0 {
+		t.Errorf("got %d spans for acquire, want none", len(spans))
+	}
+	if ms := rec.Measurements(otelx.MetricOperationDuration); len(ms) != 0 {
+		t.Errorf("got %d duration measurements for acquire, want none", len(ms))
+	}
+	ws := rec.Measurements(otelx.MetricConnectionWait)
+	if len(ws) != 1 || ws[0].Value != 0.02 {
+		t.Fatalf("wait measurements = %v, want one of 0.02", ws)
+	}
+	if ws[0].Attributes["db.system"] != "postgresql" {
+		t.Errorf("attributes = %v, want db.system", ws[0].Attributes)
+	}
+}
+
+func TestRecorderReset(t *testing.T) {
+	rec := otelx.NewRecorder()
+	h := otelx.NewHook(otelx.Config{Tracer: rec, Meter: rec})
+	send(h, &dbx.Event{Op: "query", SQL: "SELECT 1"})
+	rec.Reset()
+	if len(rec.Spans()) != 0 || len(rec.Measurements(otelx.MetricOperationDuration)) != 0 {
+		t.Error("Reset kept recorded data")
+	}
+}
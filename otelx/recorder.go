@@ -0,0 +1,126 @@
+package otelx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span captured by a Recorder
+type RecordedSpan struct {
+	Name        string
+	Attributes  map[string]any
+	Errors      []error
+	Status      StatusCode
+	Description string
+	Start       time.Time
+	End         time.Time // zero until the span ended
+}
+
+// Measurement is a histogram value captured by a Recorder
+type Measurement struct {
+	Value      float64
+	Attributes map[string]any
+}
+
+// Recorder is an in-memory Tracer and Meter, meant for tests that need no collector
+type Recorder struct {
+	mu           sync.Mutex
+	spans        []*RecordedSpan
+	measurements map[string][]Measurement
+}
+
+// NewRecorder returns an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{measurements: make(map[string][]Measurement)}
+}
+
+// Spans returns a copy of the spans started so far
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+	}
+	return spans
+}
+
+// Measurements returns a copy of the values recorded by the named histogram
+func (r *Recorder) Measurements(name string) []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Measurement(nil), r.measurements[name]...)
+}
+
+// Reset discards everything recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+	r.measurements = make(map[string][]Measurement)
+}
+
+// Start implements Tracer
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &RecordedSpan{Name: name, Attributes: make(map[string]any), Start: time.Now()}
+	setAttributes(s.Attributes, attrs)
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return ctx, &recorderSpan{r: r, s: s}
+}
+
+// Histogram implements Meter
+func (r *Recorder) Histogram(name, unit, description string) Histogram {
+	return recorderHistogram{r: r, name: name}
+}
+
+type recorderSpan struct {
+	r *Recorder
+	s *RecordedSpan
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	setAttributes(s.s.Attributes, attrs)
+}
+
+func (s *recorderSpan) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Errors = append(s.s.Errors, err)
+}
+
+func (s *recorderSpan) SetStatus(code StatusCode, description string) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Status = code
+	s.s.Description = description
+}
+
+func (s *recorderSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.End = time.Now()
+}
+
+type recorderHistogram struct {
+	r    *Recorder
+	name string
+}
+
+func (h recorderHistogram) Record(ctx context.Context, value float64, attrs ...Attribute) {
+	m := Measurement{Value: value, Attributes: make(map[string]any)}
+	setAttributes(m.Attributes, attrs)
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	h.r.measurements[h.name] = append(h.r.measurements[h.name], m)
+}
+
+func setAttributes(dst map[string]any, attrs []Attribute) {
+	for _, a := range attrs {
+		dst[a.Key] = a.Value
+	}
+}
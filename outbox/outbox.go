@@ -0,0 +1,115 @@
+// Package outbox implements the transactional outbox pattern on top of dbx.
+//
+// Enqueue writes a message to the outbox table in the caller's transaction, so it is stored
+// if and only if the transaction commits. A relay claims undelivered messages with
+// SELECT ... FOR UPDATE SKIP LOCKED, hands them to a publisher and marks them delivered,
+// retrying failures with exponential backoff. Enqueue notifies the relay with pg_notify,
+// so it does not have to poll for new messages.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// Message is a message stored in the outbox
+type Message struct {
+	ID        int64
+	Topic     string
+	Payload   json.RawMessage
+	Attempts  int // failed deliveries so far
+	CreatedAt time.Time
+}
+
+// Publisher delivers a message, e.g. to a message broker. Returning an error schedules a retry.
+type Publisher func(ctx context.Context, msg *Message) error
+
+// Option configures an Outbox
+type Option func(*Outbox)
+
+// WithTable sets the outbox table, "dbx_outbox" by default. The name may be schema-qualified.
+func WithTable(name string) Option {
+	return func(o *Outbox) {
+		o.table = name
+	}
+}
+
+// WithChannel sets the channel used to notify relays, by default the table name
+func WithChannel(channel string) Option {
+	return func(o *Outbox) {
+		o.channel = channel
+	}
+}
+
+// Outbox is an outbox table
+type Outbox struct {
+	table   string
+	channel string
+}
+
+// New returns an outbox
+func New(opts ...Option) *Outbox {
+	o := &Outbox{table: "dbx_outbox"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.channel == "" {
+		o.channel = o.table
+	}
+	return o
+}
+
+var std = New()
+
+// Enqueue writes a message to the default outbox table in tx
+func Enqueue(ctx context.Context, tx dbx.Tx, topic string, payload any) error {
+	return std.Enqueue(ctx, tx, topic, payload)
+}
+
+func (o *Outbox) ident() string {
+	return pgx.Identifier(strings.Split(o.table, ".")).Sanitize()
+}
+
+// CreateTable creates the outbox table if it does not exist, using the querier of ctx
+func (o *Outbox) CreateTable(ctx context.Context) error {
+	index := pgx.Identifier{strings.ReplaceAll(o.table, ".", "_") + "_pending_idx"}.Sanitize()
+	_, err := dbx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	topic text NOT NULL,
+	payload jsonb NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	attempts int NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	last_error text,
+	delivered_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at) WHERE delivered_at IS NULL`, o.ident(), index, o.ident()))
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+// Enqueue writes a message to the outbox in tx and notifies the relays when tx commits.
+// A []byte or json.RawMessage payload is stored as is, other payloads are marshaled to JSON.
+func (o *Outbox) Enqueue(ctx context.Context, tx dbx.Tx, topic string, payload any) error {
+	data, err := jobutil.MarshalJSON(payload)
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "INSERT INTO "+o.ident()+" (topic, payload) VALUES ($1, $2)", topic, data); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", o.channel, topic); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// listen is replaced by tests that run without a server
+var listen = jobutil.Listen
+
+// RelayOptions configures Relay
+type RelayOptions struct {
+	BatchSize    int             // messages claimed per transaction, 100 if zero
+	PollInterval time.Duration   // how often to look for messages without a notification, 30s if zero; after a batch that claimed nothing, a tenth of it is the shortest pause
+	MinBackoff   time.Duration   // delay before the first retry, 1s if zero
+	MaxBackoff   time.Duration   // maximum delay between retries, 5m if zero
+	MaxAttempts  int             // deliveries before a message is given up, unlimited if zero
+	ListenConfig *pgx.ConnConfig // connection for LISTEN, the config of the package-level connection if nil
+	OnError      func(error)     // called for failed deliveries and database errors, if not nil
+}
+
+func (opts *RelayOptions) withDefaults() RelayOptions {
+	o := RelayOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = 100
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = 30 * time.Second
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	return o
+}
+
+// Relay delivers messages with publish until ctx is done. Statements run on the querier of ctx,
+// which should be a pool, e.g. dbx.WithQuerier(ctx, dbx.Use("main")), since every batch holds a
+// transaction while publishing. Several relays may run at once; each message is claimed by one.
+// Messages are delivered at least once and in order of enqueueing, except when retried.
+func (o *Outbox) Relay(ctx context.Context, publish Publisher, opts *RelayOptions) error {
+	cfg := opts.withDefaults()
+
+	waker, err := listen(ctx, cfg.ListenConfig, o.channel, func(err error) {
+		if cfg.OnError != nil {
+			cfg.OnError(fmt.Errorf("outbox: %w", err))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("outbox: listen: %w", err)
+	}
+	defer waker.Close()
+
+	for {
+		n, err := o.relayBatch(ctx, publish, &cfg)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && cfg.OnError != nil {
+			cfg.OnError(err)
+		}
+		if err == nil && n == cfg.BatchSize {
+			continue
+		}
+
+		wait := cfg.PollInterval
+		if err == nil {
+			if due, ok := o.nextDue(ctx); ok && due < wait {
+				wait = due
+			}
+		}
+		if n == 0 {
+			// due messages may be locked by another relay; nextDue cannot tell, so do not poll them in a loop
+			wait = max(wait, cfg.PollInterval/10)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-waker.C:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// relayBatch claims up to BatchSize due messages, publishes them and records the outcome in one transaction.
+// It returns the number of messages claimed.
+func (o *Outbox) relayBatch(ctx context.Context, publish Publisher, cfg *RelayOptions) (n int, err error) {
+	tx, err := dbx.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(context.Background())
+		}
+	}()
+
+	rows, err := tx.Query(ctx, `SELECT id, topic, payload, attempts, created_at FROM `+o.ident()+`
+WHERE delivered_at IS NULL AND next_attempt_at <= now()
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	msgs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Message, error) {
+		m := &Message{}
+		return m, row.Scan(&m.ID, &m.Topic, &m.Payload, &m.Attempts, &m.CreatedAt)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+
+	var failures []error
+	for _, m := range msgs {
+		if perr := publish(ctx, m); perr != nil {
+			failures = append(failures, fmt.Errorf("outbox: publish message %d (%s): %w", m.ID, m.Topic, perr))
+			if err := o.retry(ctx, tx, m, perr, cfg); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx, "UPDATE "+o.ident()+" SET delivered_at = now() WHERE id = $1", m.ID); err != nil {
+			return 0, fmt.Errorf("outbox: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	if len(failures) > 0 && cfg.OnError != nil {
+		cfg.OnError(errors.Join(failures...))
+	}
+	return len(msgs), nil
+}
+
+// retry records a failed delivery and schedules the next attempt, or gives the message up after MaxAttempts
+func (o *Outbox) retry(ctx context.Context, tx dbx.Tx, m *Message, perr error, cfg *RelayOptions) error {
+	attempts := m.Attempts + 1
+	giveUp := cfg.MaxAttempts > 0 && attempts >= cfg.MaxAttempts
+	_, err := tx.Exec(ctx, "UPDATE "+o.ident()+` SET attempts = $2, last_error = $3,
+	next_attempt_at = CASE WHEN $4 THEN 'infinity' ELSE now() + make_interval(secs => $5) END
+WHERE id = $1`, m.ID, attempts, perr.Error(), giveUp, jobutil.Backoff(attempts, cfg.MinBackoff, cfg.MaxBackoff).Seconds())
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+// nextDue returns how long until the next undelivered message is due, or false if none is
+func (o *Outbox) nextDue(ctx context.Context) (time.Duration, bool) {
+	var seconds *float64
+	err := dbx.QueryRow(ctx, `SELECT EXTRACT(EPOCH FROM GREATEST(min(next_attempt_at) - now(), interval '0'))::float8 FROM `+o.ident()+`
+WHERE delivered_at IS NULL AND next_attempt_at < 'infinity'`).Scan(&seconds)
+	if err != nil || seconds == nil {
+		return 0, false
+	}
+	return time.Duration(*seconds * float64(time.Second)), true
+}
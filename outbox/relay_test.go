@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// fakeDB is an outbox table with one message, whose row lock is held by the transaction that claimed it
+type fakeDB struct {
+	queries atomic.Int64
+
+	mu        sync.Mutex
+	locked    bool
+	delivered bool
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (dbx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	panic("unexpected Query: " + sql)
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	panic("unexpected Exec: " + sql)
+}
+
+// QueryRow answers nextDue: the message is due now until delivered, locked or not
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) dbx.Row {
+	db.queries.Add(1)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var due *float64
+	if !db.delivered {
+		due = new(float64)
+	}
+	return rowFunc(func(dest ...any) error {
+		*dest[0].(**float64) = due
+		return nil
+	})
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db    *fakeDB
+	holds bool // the transaction claimed the message
+}
+
+// Query answers the claim of relayBatch, skipping the message while another transaction holds it
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	tx.db.queries.Add(1)
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if tx.db.locked || tx.db.delivered {
+		return &fakeRows{}, nil
+	}
+	tx.db.locked, tx.holds = true, true
+	return &fakeRows{values: [][]any{{int64(1), "user.created", json.RawMessage(`{}`), 0, time.Now()}}}, nil
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	tx.db.queries.Add(1)
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.release(true)
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.release(false)
+	return nil
+}
+
+func (tx *fakeTx) release(commit bool) {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if tx.holds {
+		tx.db.locked, tx.holds = false, false
+		tx.db.delivered = commit
+	}
+}
+
+type rowFunc func(dest ...any) error
+
+func (f rowFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
+// fakeRows returns values of exactly the scanned types
+type fakeRows struct {
+	pgx.Rows
+	values [][]any
+	pos    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[r.pos-1][i]))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+
+// TestRelayLockedRows runs two relays while one of them publishes the only due message for a while.
+// The other one claims nothing, since the row is locked, and must not query in a tight loop meanwhile.
+func TestRelayLockedRows(t *testing.T) {
+	listen = func(context.Context, *pgx.ConnConfig, string, func(error)) (*jobutil.Waker, error) {
+		return jobutil.NewWaker(), nil
+	}
+	t.Cleanup(func() { listen = jobutil.Listen })
+
+	db := &fakeDB{}
+	ctx, cancel := context.WithCancel(dbx.WithQuerier(context.Background(), db))
+	defer cancel()
+
+	const publishTime = 300 * time.Millisecond
+	var published atomic.Int32
+	publish := func(ctx context.Context, m *Message) error {
+		published.Add(1)
+		time.Sleep(publishTime)
+		return nil
+	}
+	opts := &RelayOptions{PollInterval: 100 * time.Millisecond, OnError: func(err error) { t.Error(err) }}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := New().Relay(ctx, publish, opts); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(publishTime + 50*time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if n := published.Load(); n != 1 {
+		t.Errorf("published %d times, want once", n)
+	}
+	// the idle relay pauses at least PollInterval/10 between batches: about 30 batches of 2 queries
+	if n := db.queries.Load(); n > 150 {
+		t.Errorf("%d queries while the message was locked, want a bounded poll", n)
+	}
+}
@@ -4,59 +4,74 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	_pgx "github.com/jackc/pgx/v5"
 )
 
 // Get selects a single row and scans it into a struct
 func Get[T any](ctx context.Context, sql string, args ...any) (*T, error) {
-	rows, err := Query(ctx, sql, args...)
+	result := new(T)
+	if err := get(ctx, querier(ctx), result, sql, args); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Select selects multiple rows and scans them into a slice of structs
+func Select[T any](ctx context.Context, sql string, args ...any) ([]*T, error) {
+	var results []*T
+	err := selectRows(ctx, querier(ctx), sql, args, func(rows _pgx.Rows) error {
+		item := new(T)
+		if err := scanRowToStruct(rows, item); err != nil {
+			return err
+		}
+		results = append(results, item)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results, nil
+}
+
+// get selects a single row from q and scans it into dest, a pointer to a struct
+func get(ctx context.Context, q Querier, dest any, sql string, args []any) error {
+	start := time.Now()
+	rows, err := q.Query(withOp(ctx, "get"), sql, args...)
+	if err != nil {
+		return wrapErr("get", sql, args, start, err)
+	}
 	defer rows.Close()
 	
 	if !rows.Next() {
 		if err := rows.Err(); err != nil {
-			return nil, err
+			return wrapErr("get", sql, args, start, err)
 		}
-		return nil, _pgx.ErrNoRows
-	}
-	
-	result := new(T)
-	err = scanRowToStruct(rows, result)
-	if err != nil {
-		return nil, err
+		return wrapErr("get", sql, args, start, _pgx.ErrNoRows)
 	}
 	
-	return result, nil
+	return wrapErr("get", sql, args, start, scanRowToStruct(rows, dest))
 }
 
-// Select selects multiple rows and scans them into a slice of structs
-func Select[T any](ctx context.Context, sql string, args ...any) ([]*T, error) {
-	rows, err := Query(ctx, sql, args...)
+// selectRows runs the query on q and calls scan for every row
+func selectRows(ctx context.Context, q Querier, sql string, args []any, scan func(_pgx.Rows) error) error {
+	start := time.Now()
+	rows, err := q.Query(withOp(ctx, "select"), sql, args...)
 	if err != nil {
-		return nil, err
+		return wrapErr("select", sql, args, start, err)
 	}
 	defer rows.Close()
 	
-	var results []*T
-	
 	for rows.Next() {
-		item := new(T)
-		err = scanRowToStruct(rows, item)
-		if err != nil {
-			return nil, err
+		if err := scan(rows); err != nil {
+			return wrapErr("select", sql, args, start, err)
 		}
-		results = append(results, item)
 	}
 	
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	
-	return results, nil
+	return wrapErr("select", sql, args, start, rows.Err())
 }
 
 // scanRowToStruct scans a row into a struct, ignoring columns that don't have corresponding struct fields
@@ -75,19 +90,9 @@ func scanRowToStruct(rows _pgx.Rows, dest any) error {
 		field := structType.Field(i)
 		fieldValue := structValue.Field(i)
 		
-		// Skip unexported fields
-		if field.PkgPath != "" {
-			continue
-		}
-		
-		// Get column name from db tag or field name
-		columnName := field.Tag.Get("db")
-		if columnName == "" {
-			columnName = strings.ToLower(field.Name)
-		}
-		
-		// Skip if tag is "-"
-		if columnName == "-" {
+		// Get column name from db tag or field name, skipping unexported fields and fields tagged "-"
+		columnName, _, ok := fieldColumn(field)
+		if !ok {
 			continue
 		}
 		
@@ -117,6 +122,7 @@ func scanRowToStruct(rows _pgx.Rows, dest any) error {
 
 // InsertStruct inserts a struct into the specified table
 // Always returns the inserted row using RETURNING *
+// Fields tagged `db:"name,readonly"` and zero fields tagged `db:"name,pk"` are left to the database
 func InsertStruct[T any](ctx context.Context, tableName string, data T) (*T, error) {
 	v := reflect.ValueOf(data)
 	t := reflect.TypeOf(data)
@@ -136,19 +142,14 @@ func InsertStruct[T any](ctx context.Context, tableName string, data T) (*T, err
 		field := t.Field(i)
 		fieldValue := v.Field(i)
 		
-		// Skip unexported fields
-		if field.PkgPath != "" {
+		// Get column name from db tag or field name, skipping unexported fields and fields tagged "-"
+		columnName, opts, ok := fieldColumn(field)
+		if !ok {
 			continue
 		}
 		
-		// Get column name from db tag or field name
-		columnName := field.Tag.Get("db")
-		if columnName == "" {
-			columnName = strings.ToLower(field.Name)
-		}
-		
-		// Skip if tag is "-"
-		if columnName == "-" {
+		// Let the database fill in generated columns and unset primary keys
+		if opts.has("readonly") || opts.has("pk") && fieldValue.IsZero() {
 			continue
 		}
 		
@@ -166,16 +167,39 @@ func InsertStruct[T any](ctx context.Context, tableName string, data T) (*T, err
 	)
 	
 	// Execute with RETURNING
-	rows, err := Query(ctx, query, values...)
+	start := time.Now()
+	rows, err := querier(ctx).Query(Primary(withOp(ctx, "insert")), query, values...)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("insert", query, values, start, err)
 	}
 	
 	// Collect the returned row
 	result, err := _pgx.CollectOneRow(rows, _pgx.RowToAddrOfStructByName[T])
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("insert", query, values, start, err)
 	}
 	
 	return result, nil
 }
+
+// tagOptions are the comma-separated options following the column name in a db tag, e.g. `db:"id,pk"`
+type tagOptions string
+
+// has reports whether option is set
+func (o tagOptions) has(option string) bool {
+	return slices.Contains(strings.Split(string(o), ","), option)
+}
+
+// fieldColumn returns the column a struct field is mapped to, the db tag up to the first comma
+// or the lowercased field name, and the tag options. It reports false for unexported fields
+// and fields tagged "-".
+func fieldColumn(field reflect.StructField) (string, tagOptions, bool) {
+	if field.PkgPath != "" {
+		return "", "", false
+	}
+	name, opts, _ := strings.Cut(field.Tag.Get("db"), ",")
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, tagOptions(opts), name != "-"
+}
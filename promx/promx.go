@@ -0,0 +1,208 @@
+// Package promx exposes dbx metrics in the Prometheus text exposition format.
+//
+// Collector follows the shape of prometheus.Collector with its own Desc and Metric
+// types, so it needs no Prometheus client library; WriteTo and ServeHTTP render the
+// text format directly.
+package promx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xtdlib/dbx"
+)
+
+// Desc describes a metric family
+type Desc struct {
+	Name string
+	Help string
+	Type string // "gauge", "counter" or "histogram"
+}
+
+// Label is a metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Bucket is a cumulative histogram bucket
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Metric is a single sample of a family. For histograms Value is the sum of observations.
+type Metric struct {
+	Desc    *Desc
+	Labels  []Label
+	Value   float64
+	Count   uint64
+	Buckets []Bucket
+}
+
+// Collector turns dbx statistics into metrics
+type Collector struct {
+	stats func() dbx.DBStats
+	descs []*Desc
+
+	open, idle, acquired        *Desc
+	acquires, acquireWait       *Desc
+	queries, duration, failures *Desc
+}
+
+// NewCollector returns a collector reading stats, or dbx.Stats if stats is nil.
+// Metric names are prefixed with namespace and an underscore unless namespace is empty.
+func NewCollector(namespace string, stats func() dbx.DBStats) *Collector {
+	if stats == nil {
+		stats = dbx.Stats
+	}
+	c := &Collector{stats: stats}
+	desc := func(name, typ, help string) *Desc {
+		if namespace != "" {
+			name = namespace + "_" + name
+		}
+		d := &Desc{Name: name, Help: help, Type: typ}
+		c.descs = append(c.descs, d)
+		return d
+	}
+	c.open = desc("dbx_connections_open", "gauge", "Number of open connections.")
+	c.idle = desc("dbx_connections_idle", "gauge", "Number of idle connections.")
+	c.acquired = desc("dbx_connections_acquired", "gauge", "Number of connections currently in use.")
+	c.acquires = desc("dbx_acquires_total", "counter", "Number of connection acquisitions from a pool.")
+	c.acquireWait = desc("dbx_acquire_wait_seconds_total", "counter", "Total time spent waiting for a pool connection.")
+	c.queries = desc("dbx_queries_total", "counter", "Number of statements by operation.")
+	c.duration = desc("dbx_query_duration_seconds", "histogram", "Statement latency by operation.")
+	c.failures = desc("dbx_query_errors_total", "counter", "Number of failed statements by SQLSTATE class.")
+	return c
+}
+
+// Describe sends the descriptions of all metric families
+func (c *Collector) Describe(ch chan<- *Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect sends the current value of every metric
+func (c *Collector) Collect(ch chan<- Metric) {
+	for _, m := range c.metrics() {
+		ch <- m
+	}
+}
+
+func (c *Collector) metrics() []Metric {
+	s := c.stats()
+	ms := []Metric{
+		{Desc: c.open, Value: float64(s.OpenConns)},
+		{Desc: c.idle, Value: float64(s.IdleConns)},
+		{Desc: c.acquired, Value: float64(s.AcquiredConns)},
+		{Desc: c.acquires, Value: float64(s.AcquireCount)},
+		{Desc: c.acquireWait, Value: s.AcquireDuration.Seconds()},
+	}
+
+	ops := make([]string, 0, len(s.Ops))
+	for op := range s.Ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		ms = append(ms, Metric{Desc: c.queries, Labels: []Label{{"op", op}}, Value: float64(s.Ops[op].Count)})
+	}
+	for _, op := range ops {
+		o := s.Ops[op]
+		m := Metric{Desc: c.duration, Labels: []Label{{"op", op}}, Value: o.Duration.Seconds(), Count: uint64(o.Count)}
+		for i, bound := range o.Bounds {
+			m.Buckets = append(m.Buckets, Bucket{UpperBound: bound, Count: uint64(o.Buckets[i])})
+		}
+		ms = append(ms, m)
+	}
+
+	classes := make([]string, 0, len(s.Errors))
+	for class := range s.Errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		ms = append(ms, Metric{Desc: c.failures, Labels: []Label{{"class", class}}, Value: float64(s.Errors[class])})
+	}
+	return ms
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	byDesc := make(map[*Desc][]Metric)
+	for _, m := range c.metrics() {
+		byDesc[m.Desc] = append(byDesc[m.Desc], m)
+	}
+	for _, d := range c.descs {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", d.Name, d.Help, d.Name, d.Type)
+		for _, m := range byDesc[d] {
+			if d.Type != "histogram" {
+				writeSample(bw, d.Name, m.Labels, m.Value)
+				continue
+			}
+			for _, b := range m.Buckets {
+				writeSample(bw, d.Name+"_bucket", append(m.Labels, Label{"le", formatFloat(b.UpperBound)}), float64(b.Count))
+			}
+			writeSample(bw, d.Name+"_bucket", append(m.Labels, Label{"le", "+Inf"}), float64(m.Count))
+			writeSample(bw, d.Name+"_sum", m.Labels, m.Value)
+			writeSample(bw, d.Name+"_count", m.Labels, float64(m.Count))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics, so a Collector can be mounted at /metrics
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+func writeSample(w io.Writer, name string, labels []Label, value float64) {
+	io.WriteString(w, name)
+	if len(labels) > 0 {
+		parts := make([]string, len(labels))
+		for i, l := range labels {
+			parts[i] = l.Name + `="` + escapeLabel(l.Value) + `"`
+		}
+		io.WriteString(w, "{"+strings.Join(parts, ",")+"}")
+	}
+	io.WriteString(w, " "+formatFloat(value)+"\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,121 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is the set of methods the package-level functions need.
+// It is implemented by *pgx.Conn, *pgxpool.Pool, Tx, *Cluster and *DB.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) Row
+	Exec(ctx context.Context, sql string, args ...any) (CommandTag, error)
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultQuerier Querier
+)
+
+// SetDefault routes the package-level Query, QueryRow, Exec, Begin, BeginTx, CopyFrom and SendBatch
+// functions and the Get, Select and InsertStruct helpers to q instead of the connection opened by Connect.
+// Passing nil restores the package-level connection.
+func SetDefault(q Querier) {
+	defaultMu.Lock()
+	defaultQuerier = q
+	defaultMu.Unlock()
+}
+
+type querierKey struct{}
+
+// WithQuerier returns a context that makes the package-level functions and helpers use q,
+// e.g. a transaction or a database registered with Register
+func WithQuerier(ctx context.Context, q Querier) context.Context {
+	return context.WithValue(ctx, querierKey{}, q)
+}
+
+// QuerierFrom returns the Querier the package-level functions use with ctx, e.g. to wrap it
+func QuerierFrom(ctx context.Context) Querier {
+	return querier(ctx)
+}
+
+// querier returns the querier used by the package-level functions: the one in ctx, the default or the package-level connection.
+// Once Shutdown was called only queriers from ctx are used, so that open transactions can finish.
+func querier(ctx context.Context) Querier {
+	if q, ok := ctx.Value(querierKey{}).(Querier); ok {
+		return q
+	}
+	if shuttingDown.Load() {
+		return errQuerier{ErrShuttingDown}
+	}
+	defaultMu.RLock()
+	q := defaultQuerier
+	defaultMu.RUnlock()
+	if q != nil {
+		return q
+	}
+	return current()
+}
+
+var errNotSupported = errors.New("dbx: operation not supported by the default querier")
+
+func begin(ctx context.Context, q Querier) (Tx, error) {
+	b, ok := q.(interface {
+		Begin(ctx context.Context) (Tx, error)
+	})
+	if !ok {
+		return nil, errNotSupported
+	}
+	return b.Begin(ctx)
+}
+
+func beginTx(ctx context.Context, q Querier, txOptions pgx.TxOptions) (Tx, error) {
+	b, ok := q.(interface {
+		BeginTx(ctx context.Context, txOptions pgx.TxOptions) (Tx, error)
+	})
+	if !ok {
+		return nil, errNotSupported
+	}
+	return b.BeginTx(ctx, txOptions)
+}
+
+func copyFrom(ctx context.Context, q Querier, tableName Identifier, columnNames []string, rowSrc CopyFromSource) (int64, error) {
+	c, ok := q.(interface {
+		CopyFrom(ctx context.Context, tableName Identifier, columnNames []string, rowSrc CopyFromSource) (int64, error)
+	})
+	if !ok {
+		return 0, errNotSupported
+	}
+	return c.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func sendBatch(ctx context.Context, q Querier, b *Batch) BatchResults {
+	s, ok := q.(interface {
+		SendBatch(ctx context.Context, b *Batch) BatchResults
+	})
+	if !ok {
+		return errBatchResults{errNotSupported}
+	}
+	return s.SendBatch(ctx, b)
+}
+
+// errBatchResults is a BatchResults that fails every call with err
+type errBatchResults struct {
+	err error
+}
+
+func (r errBatchResults) Exec() (CommandTag, error) { return CommandTag{}, r.err }
+func (r errBatchResults) Query() (Rows, error)      { return nil, r.err }
+func (r errBatchResults) QueryRow() Row             { return errRow{r.err} }
+func (r errBatchResults) Close() error              { return r.err }
+
+// errRow is a Row whose Scan fails with err
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error { return r.err }
@@ -0,0 +1,214 @@
+// Package queue is a PostgreSQL-backed job queue on top of dbx.
+//
+// Jobs are enqueued with a kind, JSON arguments, a priority, an optional run-at time, an optional
+// unique key and a maximum number of attempts. Workers claim due jobs with SELECT ... FOR UPDATE
+// SKIP LOCKED, keep them alive with heartbeats while they run, retry failures with exponential
+// backoff and move jobs out of attempts to the dead state. Enqueue wakes idle workers with pg_notify.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// ErrDuplicate is returned by Enqueue when a job of the same kind and unique key is pending or running
+var ErrDuplicate = errors.New("queue: duplicate job")
+
+// ErrLostClaim is reported by workers when a job's heartbeat timed out and another worker claimed it,
+// so the result of the first run is discarded
+var ErrLostClaim = errors.New("queue: job was claimed by another worker")
+
+// Job states
+const (
+	StateAvailable = "available" // waiting for run_at or a worker
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateDead      = "dead" // failed MaxAttempts times
+)
+
+// Job is a claimed job
+type Job struct {
+	ID          int64
+	Kind        string
+	Args        json.RawMessage
+	Priority    int
+	Attempt     int // 1 for the first run
+	MaxAttempts int
+	RunAt       time.Time
+	CreatedAt   time.Time
+	LastError   *string
+}
+
+// EnqueueOptions configures a job
+type EnqueueOptions struct {
+	Priority    int       // jobs with higher priority run first
+	RunAt       time.Time // the job does not run before RunAt; now if zero
+	UniqueKey   string    // if set, the job is not enqueued while a job of its kind with this key is pending or running
+	MaxAttempts int       // runs before the job is dead, 25 if zero
+}
+
+// Option configures a Queue
+type Option func(*Queue)
+
+// WithTable sets the jobs table, "dbx_jobs" by default. The name may be schema-qualified.
+func WithTable(name string) Option {
+	return func(q *Queue) {
+		q.table = name
+	}
+}
+
+// WithChannel sets the channel used to wake workers, by default the table name
+func WithChannel(channel string) Option {
+	return func(q *Queue) {
+		q.channel = channel
+	}
+}
+
+// Queue is a jobs table
+type Queue struct {
+	table   string
+	channel string
+}
+
+// New returns a queue
+func New(opts ...Option) *Queue {
+	q := &Queue{table: "dbx_jobs"}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.channel == "" {
+		q.channel = q.table
+	}
+	return q
+}
+
+var std = New()
+
+// Enqueue adds a job to the default queue
+func Enqueue(ctx context.Context, kind string, args any, opts *EnqueueOptions) (int64, error) {
+	return std.Enqueue(ctx, kind, args, opts)
+}
+
+func (q *Queue) ident() string {
+	return pgx.Identifier(strings.Split(q.table, ".")).Sanitize()
+}
+
+// indexIdent returns the identifier of an index on the table with suffix
+func (q *Queue) indexIdent(suffix string) string {
+	return pgx.Identifier{strings.ReplaceAll(q.table, ".", "_") + "_" + suffix}.Sanitize()
+}
+
+// CreateTable creates the jobs table if it does not exist, using the querier of ctx
+func (q *Queue) CreateTable(ctx context.Context) error {
+	_, err := dbx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	kind text NOT NULL,
+	args jsonb NOT NULL DEFAULT '{}',
+	priority int NOT NULL DEFAULT 0,
+	run_at timestamptz NOT NULL DEFAULT now(),
+	unique_key text,
+	state text NOT NULL DEFAULT 'available',
+	attempts int NOT NULL DEFAULT 0,
+	max_attempts int NOT NULL DEFAULT 25,
+	last_error text,
+	heartbeat_at timestamptz,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	finished_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS %[2]s ON %[1]s (kind, unique_key)
+	WHERE unique_key IS NOT NULL AND state IN ('available', 'running');
+CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (priority DESC, run_at, id) WHERE state = 'available'`,
+		q.ident(), q.indexIdent("unique_idx"), q.indexIdent("fetch_idx")))
+	if err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	return nil
+}
+
+// Enqueue adds a job and returns its ID, using the querier of ctx, so it can be enqueued in a transaction.
+// Args are encoded like outbox payloads: []byte and json.RawMessage as is, other values marshaled to JSON.
+func (q *Queue) Enqueue(ctx context.Context, kind string, args any, opts *EnqueueOptions) (int64, error) {
+	if opts == nil {
+		opts = &EnqueueOptions{}
+	}
+	data, err := jobutil.MarshalJSON(args)
+	if err != nil {
+		return 0, fmt.Errorf("queue: %w", err)
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 25
+	}
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	var uniqueKey *string
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	}
+
+	var id int64
+	err = dbx.QueryRow(ctx, `INSERT INTO `+q.ident()+` (kind, args, priority, run_at, unique_key, max_attempts)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND state IN ('available', 'running') DO NOTHING
+RETURNING id`, kind, data, opts.Priority, runAt, uniqueKey, maxAttempts).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrDuplicate
+	}
+	if err != nil {
+		return 0, fmt.Errorf("queue: %w", err)
+	}
+
+	if !runAt.After(time.Now()) {
+		if _, err := dbx.Exec(ctx, "SELECT pg_notify($1, $2)", q.channel, kind); err != nil {
+			return 0, fmt.Errorf("queue: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// DeadJobs returns up to limit dead jobs, most recently failed first
+func (q *Queue) DeadJobs(ctx context.Context, limit int) ([]*Job, error) {
+	rows, err := dbx.Query(ctx, `SELECT id, kind, args, priority, attempts, max_attempts, run_at, created_at, last_error
+FROM `+q.ident()+` WHERE state = 'dead' ORDER BY finished_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("queue: %w", err)
+	}
+	jobs, err := pgx.CollectRows(rows, scanJob)
+	if err != nil {
+		return nil, fmt.Errorf("queue: %w", err)
+	}
+	return jobs, nil
+}
+
+// Retry makes a dead job available again with its attempts reset
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	tag, err := dbx.Exec(ctx, `UPDATE `+q.ident()+` SET state = 'available', attempts = 0, run_at = now(), finished_at = NULL
+WHERE id = $1 AND state = 'dead'`, id)
+	if err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("queue: job %d is not dead", id)
+	}
+	if _, err := dbx.Exec(ctx, "SELECT pg_notify($1, kind) FROM "+q.ident()+" WHERE id = $2", q.channel, id); err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	return nil
+}
+
+func scanJob(row pgx.CollectableRow) (*Job, error) {
+	j := &Job{}
+	err := row.Scan(&j.ID, &j.Kind, &j.Args, &j.Priority, &j.Attempt, &j.MaxAttempts, &j.RunAt, &j.CreatedAt, &j.LastError)
+	return j, err
+}
@@ -0,0 +1,259 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// Handler runs a job. Returning an error retries the job with backoff, or moves it to the dead
+// state after its last attempt. ctx is canceled when the worker stops or JobTimeout passes.
+type Handler func(ctx context.Context, job *Job) error
+
+// listen is replaced by tests that run without a server
+var listen = jobutil.Listen
+
+// WorkerOptions configures Work
+type WorkerOptions struct {
+	Concurrency       int             // jobs run at once, 10 if zero
+	PollInterval      time.Duration   // how often to look for due jobs without a notification, 5s if zero
+	HeartbeatInterval time.Duration   // how often running jobs are marked alive, 10s if zero
+	HeartbeatTimeout  time.Duration   // running jobs without a heartbeat for this long are claimed again, 1m if zero
+	JobTimeout        time.Duration   // limit for a single run, none if zero
+	MinBackoff        time.Duration   // delay before the first retry, 1s if zero
+	MaxBackoff        time.Duration   // maximum delay between retries, 1h if zero
+	ListenConfig      *pgx.ConnConfig // connection for LISTEN, the config of the package-level connection if nil
+	OnError           func(error)     // called for failed jobs and database errors, if not nil
+}
+
+func (opts *WorkerOptions) withDefaults() WorkerOptions {
+	o := WorkerOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = 10
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.HeartbeatInterval == 0 {
+		o.HeartbeatInterval = 10 * time.Second
+	}
+	if o.HeartbeatTimeout == 0 {
+		o.HeartbeatTimeout = time.Minute
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = time.Hour
+	}
+	return o
+}
+
+// worker is the state of a running Work call
+type worker struct {
+	q        *Queue
+	handlers map[string]Handler
+	kinds    []string
+	cfg      WorkerOptions
+	waker    *jobutil.Waker // also signaled when a slot frees up or a job is retried
+}
+
+func (w *worker) report(err error) {
+	if w.cfg.OnError != nil {
+		w.cfg.OnError(err)
+	}
+}
+
+// Work runs jobs of the kinds in handlers until ctx is done, then waits for running jobs to return.
+// Jobs whose handler fails after ctx is done are made available again without using up an attempt.
+// Up to Concurrency jobs, their heartbeats and their results use the querier of ctx at the same time,
+// so it must be safe for concurrent use, like a pool registered with dbx.Register and not the
+// package-level connection. Several workers, in one or more processes, may work on the same queue.
+func (q *Queue) Work(ctx context.Context, handlers map[string]Handler, opts *WorkerOptions) error {
+	w := &worker{q: q, handlers: handlers, cfg: opts.withDefaults()}
+	for kind := range handlers {
+		w.kinds = append(w.kinds, kind)
+	}
+
+	var err error
+	if w.waker, err = listen(ctx, w.cfg.ListenConfig, q.channel, func(err error) {
+		w.report(fmt.Errorf("queue: %w", err))
+	}); err != nil {
+		return fmt.Errorf("queue: listen: %w", err)
+	}
+	defer w.waker.Close()
+
+	// results are recorded after ctx is done, so that stopping does not lose them
+	bg := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, w.cfg.Concurrency)
+	for {
+		free := w.cfg.Concurrency - len(slots)
+		if free > 0 {
+			jobs, err := w.claim(ctx, free)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				w.report(err)
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w.run(ctx, bg, job)
+					<-slots
+					w.waker.Signal()
+				}()
+			}
+			if err == nil && len(jobs) == free {
+				continue
+			}
+		}
+
+		timer := time.NewTimer(w.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-w.waker.C:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// claim marks up to n due jobs, and running jobs whose heartbeat timed out, as running and returns them.
+// Timed-out jobs without attempts left are moved to the dead state instead.
+func (w *worker) claim(ctx context.Context, n int) ([]*Job, error) {
+	ident := w.q.ident()
+	_, err := dbx.Exec(ctx, `UPDATE `+ident+` SET state = 'dead', finished_at = now(), heartbeat_at = NULL, last_error = 'heartbeat timeout'
+WHERE kind = ANY($1) AND state = 'running' AND heartbeat_at < now() - make_interval(secs => $2) AND attempts >= max_attempts`,
+		w.kinds, w.cfg.HeartbeatTimeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("queue: claim: %w", err)
+	}
+
+	rows, err := dbx.Query(ctx, `UPDATE `+ident+` SET state = 'running', attempts = attempts + 1, heartbeat_at = now(),
+	last_error = CASE WHEN state = 'running' THEN 'heartbeat timeout' ELSE last_error END
+WHERE id IN (
+	SELECT id FROM `+ident+`
+	WHERE kind = ANY($1) AND (
+		state = 'available' AND run_at <= now()
+		OR state = 'running' AND heartbeat_at < now() - make_interval(secs => $3) AND attempts < max_attempts)
+	ORDER BY priority DESC, run_at, id
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED)
+RETURNING id, kind, args, priority, attempts, max_attempts, run_at, created_at, last_error`,
+		w.kinds, n, w.cfg.HeartbeatTimeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("queue: claim: %w", err)
+	}
+	jobs, err := pgx.CollectRows(rows, scanJob)
+	if err != nil {
+		return nil, fmt.Errorf("queue: claim: %w", err)
+	}
+	return jobs, nil
+}
+
+// run runs job with heartbeats and records the result using bg, which outlives ctx
+func (w *worker) run(ctx, bg context.Context, job *Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	if w.cfg.JobTimeout > 0 {
+		jobCtx, cancel = context.WithTimeout(ctx, w.cfg.JobTimeout)
+	}
+	defer cancel()
+
+	done := make(chan struct{})
+	go w.heartbeat(jobCtx, job, done)
+	err := w.call(jobCtx, job)
+	close(done)
+
+	// the state and attempt guard against overwriting a run of another worker that reclaimed the job
+	if err == nil {
+		tag, err := dbx.Exec(bg, `UPDATE `+w.q.ident()+` SET state = 'completed', finished_at = now(), heartbeat_at = NULL
+WHERE id = $1 AND state = 'running' AND attempts = $2`, job.ID, job.Attempt)
+		switch {
+		case err != nil:
+			w.report(fmt.Errorf("queue: complete job %d: %w", job.ID, err))
+		case tag.RowsAffected() == 0:
+			w.report(fmt.Errorf("queue: complete job %d attempt %d: %w", job.ID, job.Attempt, ErrLostClaim))
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// the worker is stopping: the run was interrupted and does not count as an attempt
+		w.release(bg, job)
+		return
+	}
+
+	w.report(fmt.Errorf("queue: job %d (%s) attempt %d: %w", job.ID, job.Kind, job.Attempt, err))
+	dead := job.Attempt >= job.MaxAttempts
+	tag, err := dbx.Exec(bg, `UPDATE `+w.q.ident()+` SET last_error = $3, heartbeat_at = NULL,
+	state = CASE WHEN $4 THEN 'dead' ELSE 'available' END,
+	finished_at = CASE WHEN $4 THEN now() END,
+	run_at = CASE WHEN $4 THEN run_at ELSE now() + make_interval(secs => $5) END
+WHERE id = $1 AND state = 'running' AND attempts = $2`, job.ID, job.Attempt, err.Error(), dead, jobutil.Backoff(job.Attempt, w.cfg.MinBackoff, w.cfg.MaxBackoff).Seconds())
+	switch {
+	case err != nil:
+		w.report(fmt.Errorf("queue: record failure of job %d: %w", job.ID, err))
+	case tag.RowsAffected() == 0:
+		w.report(fmt.Errorf("queue: record failure of job %d attempt %d: %w", job.ID, job.Attempt, ErrLostClaim))
+	case !dead:
+		w.waker.Signal()
+	}
+}
+
+// release makes job available again without using up the attempt it was claimed for
+func (w *worker) release(ctx context.Context, job *Job) {
+	tag, err := dbx.Exec(ctx, `UPDATE `+w.q.ident()+` SET state = 'available', attempts = attempts - 1, run_at = now(), heartbeat_at = NULL
+WHERE id = $1 AND state = 'running' AND attempts = $2`, job.ID, job.Attempt)
+	switch {
+	case err != nil:
+		w.report(fmt.Errorf("queue: release job %d: %w", job.ID, err))
+	case tag.RowsAffected() == 0:
+		w.report(fmt.Errorf("queue: release job %d attempt %d: %w", job.ID, job.Attempt, ErrLostClaim))
+	}
+}
+
+// call runs the handler of job, turning a panic into an error
+func (w *worker) call(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return w.handlers[job.Kind](ctx, job)
+}
+
+// heartbeat marks the job alive every HeartbeatInterval until done is closed
+func (w *worker) heartbeat(ctx context.Context, job *Job, done <-chan struct{}) {
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := dbx.Exec(ctx, "UPDATE "+w.q.ident()+" SET heartbeat_at = now() WHERE id = $1 AND state = 'running' AND attempts = $2",
+				job.ID, job.Attempt)
+			if err != nil && ctx.Err() == nil {
+				w.report(fmt.Errorf("queue: heartbeat job %d: %w", job.ID, err))
+			}
+		}
+	}
+}
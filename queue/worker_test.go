@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdlib/dbx"
+	"github.com/xtdlib/dbx/internal/jobutil"
+)
+
+// fakeDB hands out one job to the first claim and records the other statements
+type fakeDB struct {
+	job []any // the claimed row
+
+	mu      sync.Mutex
+	claimed bool
+	execs   []exec
+}
+
+type exec struct {
+	sql  string
+	args []any
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (dbx.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.claimed {
+		return &fakeRows{}, nil
+	}
+	db.claimed = true
+	return &fakeRows{values: [][]any{db.job}}, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) dbx.Row {
+	panic("unexpected QueryRow: " + sql)
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...any) (dbx.CommandTag, error) {
+	if err := ctx.Err(); err != nil {
+		return dbx.CommandTag{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = append(db.execs, exec{sql, args})
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+// fakeRows returns values of exactly the scanned types
+type fakeRows struct {
+	pgx.Rows
+	values [][]any
+	pos    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[r.pos-1][i]))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("UPDATE") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+
+// TestWorkStopReleasesJob stops a worker while a job on its last attempt runs. The interrupted run
+// must give the attempt back instead of being recorded as a failure, which would dead-letter the job.
+func TestWorkStopReleasesJob(t *testing.T) {
+	listen = func(context.Context, *pgx.ConnConfig, string, func(error)) (*jobutil.Waker, error) {
+		return jobutil.NewWaker(), nil
+	}
+	t.Cleanup(func() { listen = jobutil.Listen })
+
+	const id, attempt = int64(42), 3
+	db := &fakeDB{job: []any{id, "email", json.RawMessage(`{}`), 0, attempt, attempt, time.Now(), time.Now(), (*string)(nil)}}
+	ctx, cancel := context.WithCancel(dbx.WithQuerier(context.Background(), db))
+	defer cancel()
+
+	started := make(chan struct{})
+	handlers := map[string]Handler{
+		"email": func(ctx context.Context, job *Job) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	var reported []error
+	opts := &WorkerOptions{PollInterval: time.Hour, HeartbeatInterval: time.Hour, OnError: func(err error) {
+		reported = append(reported, err)
+	}}
+
+	done := make(chan error)
+	go func() {
+		done <- New().Work(ctx, handlers, opts)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var releases int
+	for _, e := range db.execs {
+		switch {
+		case strings.Contains(e.sql, "'dead'") && !strings.Contains(e.sql, "heartbeat timeout"):
+			t.Errorf("interrupted job recorded as a failure: %s %v", e.sql, e.args)
+		case strings.Contains(e.sql, "attempts = attempts - 1"):
+			releases++
+			if !strings.Contains(e.sql, "state = 'available'") || !strings.Contains(e.sql, "attempts = $2") {
+				t.Errorf("release does not make the claimed attempt available: %s", e.sql)
+			}
+			if !reflect.DeepEqual(e.args, []any{id, attempt}) {
+				t.Errorf("release args = %v, want [%d %d]", e.args, id, attempt)
+			}
+		}
+	}
+	if releases != 1 {
+		t.Errorf("released %d times, want once", releases)
+	}
+	for _, err := range reported {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("reported %v", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DB is a named database registered with Register.
+// It implements Querier, so it can also be passed to WithQuerier to run the generic helpers against it.
+type DB struct {
+	name    string
+	pool    *pgxpool.Pool
+	metrics *metrics
+}
+
+var _ Querier = (*DB)(nil)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*DB)
+)
+
+// Register creates a connection pool for config and registers it under name.
+// Connections are dialed lazily, on first use.
+func Register(name string, config *pgxpool.Config, opts ...Option) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("dbx: database %q is already registered", name)
+	}
+
+	config = config.Copy()
+	db := &DB{name: name, metrics: newMetrics()}
+	config.ConnConfig = applyOptions(config.ConnConfig, db.metrics, opts)
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return fmt.Errorf("dbx: database %q: %w", name, err)
+	}
+	db.pool = pool
+	registry[name] = db
+	return nil
+}
+
+// Lookup returns the database registered under name
+func Lookup(name string) (*DB, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	db, ok := registry[name]
+	return db, ok
+}
+
+// Use returns the database registered under name. It panics if there is none.
+func Use(name string) *DB {
+	db, ok := Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("dbx: database %q is not registered", name))
+	}
+	return db
+}
+
+// Unregister closes the database registered under name and removes it from the registry
+func Unregister(name string) {
+	registryMu.Lock()
+	db, ok := registry[name]
+	delete(registry, name)
+	registryMu.Unlock()
+	if ok {
+		db.pool.Close()
+	}
+}
+
+// Name returns the name the database was registered under
+func (db *DB) Name() string {
+	return db.name
+}
+
+// Pool returns the underlying connection pool
+func (db *DB) Pool() *pgxpool.Pool {
+	return db.pool
+}
+
+// Query executes a query that returns rows
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	return db.pool.Query(ctx, sql, args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	return db.pool.QueryRow(ctx, sql, args...)
+}
+
+// Exec executes a query without returning any rows
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
+	return db.pool.Exec(ctx, sql, args...)
+}
+
+// Begin starts a transaction
+func (db *DB) Begin(ctx context.Context) (Tx, error) {
+	return db.pool.Begin(ctx)
+}
+
+// BeginTx starts a transaction with options
+func (db *DB) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (Tx, error) {
+	return db.pool.BeginTx(ctx, txOptions)
+}
+
+// CopyFrom performs a copy from operation
+func (db *DB) CopyFrom(ctx context.Context, tableName Identifier, columnNames []string, rowSrc CopyFromSource) (int64, error) {
+	return db.pool.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// SendBatch sends a batch of queries
+func (db *DB) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	return db.pool.SendBatch(ctx, b)
+}
+
+// Ping verifies a connection to the database can be established
+func (db *DB) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
+
+// Get selects a single row and scans it into dest, which must be a pointer to a struct
+func (db *DB) Get(ctx context.Context, dest any, sql string, args ...any) error {
+	return get(ctx, db, dest, sql, args)
+}
+
+// Select selects multiple rows into dest, which must be a pointer to a slice of structs or of pointers to structs
+func (db *DB) Select(ctx context.Context, dest any, sql string, args ...any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice")
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	slice.SetLen(0)
+	return selectRows(ctx, db, sql, args, func(rows Rows) error {
+		item := reflect.New(elemType)
+		if err := scanRowToStruct(rows, item.Interface()); err != nil {
+			return err
+		}
+		if !isPtr {
+			item = item.Elem()
+		}
+		slice.Set(reflect.Append(slice, item))
+		return nil
+	})
+}
+
+// Stats returns a snapshot of the database's metrics
+func (db *DB) Stats() DBStats {
+	var stats DBStats
+	db.metrics.snapshot(&stats)
+	s := db.pool.Stat()
+	stats.OpenConns = s.TotalConns()
+	stats.IdleConns = s.IdleConns()
+	stats.AcquiredConns = s.AcquiredConns()
+	return stats
+}
@@ -0,0 +1,313 @@
+// Package schema describes tables, constraints, indexes and types by querying pg_catalog.
+//
+// It is the foundation for struct validation and code generation. The functions accept any
+// Querier, such as *pgx.Conn, *pgxpool.Pool, a transaction or a dbx database.
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotFound is returned by DescribeTable when the table does not exist
+var ErrNotFound = errors.New("schema: table not found")
+
+// Querier runs catalog queries
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Table describes a table
+type Table struct {
+	OID         uint32
+	Schema      string
+	Name        string
+	Columns     []Column
+	PrimaryKey  *Constraint // nil if the table has none
+	Uniques     []Constraint
+	ForeignKeys []ForeignKey
+	Indexes     []Index
+}
+
+// Column returns the column with name, or nil
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Column describes a table column or a composite type attribute
+type Column struct {
+	Name      string
+	Position  int
+	Type      string // formatted type, e.g. "numeric(20,8)" or "text[]"
+	TypeName  string // name of the type in pg_type, e.g. "numeric" or "_text" for arrays
+	TypeOID   uint32
+	IsArray   bool
+	NotNull   bool
+	Default   *string // default expression, or generation expression of a generated column
+	Identity  string  // "always", "by default" or "" if not an identity column
+	Generated bool    // stored generated column
+}
+
+// Constraint is a primary key or unique constraint
+type Constraint struct {
+	Name    string
+	Columns []string
+}
+
+// ForeignKey is a foreign key constraint
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+	OnUpdate   string // "no action", "restrict", "cascade", "set null" or "set default"
+	OnDelete   string
+}
+
+// Index describes an index
+type Index struct {
+	Name       string
+	Columns    []string // empty strings stand for expressions
+	Unique     bool
+	Primary    bool
+	Method     string // e.g. "btree"
+	Definition string // CREATE INDEX statement
+}
+
+// Enum is an enum type
+type Enum struct {
+	Schema string
+	Name   string
+	Values []string
+}
+
+// CompositeType is a composite type created with CREATE TYPE ... AS
+type CompositeType struct {
+	Schema     string
+	Name       string
+	Attributes []Column
+}
+
+// DescribeTable describes the table name, which may be schema-qualified and is resolved with the search path
+func DescribeTable(ctx context.Context, q Querier, name string) (*Table, error) {
+	tables, err := describeTables(ctx, q, `SELECT c.oid, n.nspname, c.relname
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.oid = to_regclass($1) AND c.relkind IN ('r', 'p', 'v', 'm', 'f')`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return tables[0], nil
+}
+
+// Tables describes every table in schemaName
+func Tables(ctx context.Context, q Querier, schemaName string) ([]*Table, error) {
+	return describeTables(ctx, q, `SELECT c.oid, n.nspname, c.relname
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relkind IN ('r', 'p')
+ORDER BY c.relname`, schemaName)
+}
+
+func describeTables(ctx context.Context, q Querier, sql string, arg any) ([]*Table, error) {
+	rows, err := q.Query(ctx, sql, arg)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Table, error) {
+		t := &Table{}
+		return t, row.Scan(&t.OID, &t.Schema, &t.Name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+
+	for _, t := range tables {
+		if t.Columns, err = columns(ctx, q, t.OID); err != nil {
+			return nil, err
+		}
+		if err := constraints(ctx, q, t); err != nil {
+			return nil, err
+		}
+		if t.Indexes, err = indexes(ctx, q, t.OID); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+func columns(ctx context.Context, q Querier, relOID uint32) ([]Column, error) {
+	rows, err := q.Query(ctx, `SELECT a.attname, a.attnum, format_type(a.atttypid, a.atttypmod), t.typname, a.atttypid,
+	t.typcategory = 'A', a.attnotnull, pg_get_expr(d.adbin, d.adrelid), a.attidentity::text, a.attgenerated::text
+FROM pg_attribute a
+JOIN pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, relOID)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	cols, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Column, error) {
+		var c Column
+		var identity, generated string
+		err := row.Scan(&c.Name, &c.Position, &c.Type, &c.TypeName, &c.TypeOID,
+			&c.IsArray, &c.NotNull, &c.Default, &identity, &generated)
+		switch identity {
+		case "a":
+			c.Identity = "always"
+		case "d":
+			c.Identity = "by default"
+		}
+		c.Generated = generated == "s"
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return cols, nil
+}
+
+var fkActions = map[string]string{
+	"a": "no action",
+	"r": "restrict",
+	"c": "cascade",
+	"n": "set null",
+	"d": "set default",
+}
+
+func constraints(ctx context.Context, q Querier, t *Table) error {
+	rows, err := q.Query(ctx, `SELECT c.conname, c.contype::text,
+	ARRAY(SELECT a.attname FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum ORDER BY k.ord)::text[],
+	COALESCE(fn.nspname, ''), COALESCE(f.relname, ''),
+	ARRAY(SELECT a.attname FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum ORDER BY k.ord)::text[],
+	c.confupdtype::text, c.confdeltype::text
+FROM pg_constraint c
+LEFT JOIN pg_class f ON f.oid = c.confrelid
+LEFT JOIN pg_namespace fn ON fn.oid = f.relnamespace
+WHERE c.conrelid = $1 AND c.contype IN ('p', 'u', 'f')
+ORDER BY c.conname`, t.OID)
+	if err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, kind, refSchema, refTable, onUpdate, onDelete string
+		var cols, refCols []string
+		if err := rows.Scan(&name, &kind, &cols, &refSchema, &refTable, &refCols, &onUpdate, &onDelete); err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+		switch kind {
+		case "p":
+			t.PrimaryKey = &Constraint{Name: name, Columns: cols}
+		case "u":
+			t.Uniques = append(t.Uniques, Constraint{Name: name, Columns: cols})
+		case "f":
+			t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+				Name:       name,
+				Columns:    cols,
+				RefSchema:  refSchema,
+				RefTable:   refTable,
+				RefColumns: refCols,
+				OnUpdate:   fkActions[onUpdate],
+				OnDelete:   fkActions[onDelete],
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	return nil
+}
+
+func indexes(ctx context.Context, q Querier, relOID uint32) ([]Index, error) {
+	rows, err := q.Query(ctx, `SELECT i.relname, ix.indisunique, ix.indisprimary, am.amname, pg_get_indexdef(ix.indexrelid),
+	ARRAY(SELECT COALESCE(a.attname, '') FROM unnest(ix.indkey::int2[]) WITH ORDINALITY k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum ORDER BY k.ord)::text[]
+FROM pg_index ix
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_am am ON am.oid = i.relam
+WHERE ix.indrelid = $1
+ORDER BY i.relname`, relOID)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	idxs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Index, error) {
+		var idx Index
+		err := row.Scan(&idx.Name, &idx.Unique, &idx.Primary, &idx.Method, &idx.Definition, &idx.Columns)
+		return idx, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return idxs, nil
+}
+
+// Enums describes every enum type in schemaName
+func Enums(ctx context.Context, q Querier, schemaName string) ([]Enum, error) {
+	rows, err := q.Query(ctx, `SELECT n.nspname, t.typname, array_agg(e.enumlabel ORDER BY e.enumsortorder)::text[]
+FROM pg_type t
+JOIN pg_enum e ON e.enumtypid = t.oid
+JOIN pg_namespace n ON n.oid = t.typnamespace
+WHERE n.nspname = $1
+GROUP BY n.nspname, t.typname
+ORDER BY t.typname`, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	enums, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Enum, error) {
+		var e Enum
+		err := row.Scan(&e.Schema, &e.Name, &e.Values)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return enums, nil
+}
+
+// CompositeTypes describes every composite type in schemaName, excluding the row types of tables
+func CompositeTypes(ctx context.Context, q Querier, schemaName string) ([]CompositeType, error) {
+	rows, err := q.Query(ctx, `SELECT n.nspname, t.typname, t.typrelid
+FROM pg_type t
+JOIN pg_namespace n ON n.oid = t.typnamespace
+JOIN pg_class c ON c.oid = t.typrelid
+WHERE n.nspname = $1 AND t.typtype = 'c' AND c.relkind = 'c'
+ORDER BY t.typname`, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	type composite struct {
+		CompositeType
+		relOID uint32
+	}
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (composite, error) {
+		var c composite
+		err := row.Scan(&c.Schema, &c.Name, &c.relOID)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+
+	types := make([]CompositeType, len(found))
+	for i, c := range found {
+		if c.Attributes, err = columns(ctx, q, c.relOID); err != nil {
+			return nil, err
+		}
+		types[i] = c.CompositeType
+	}
+	return types, nil
+}
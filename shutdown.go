@@ -0,0 +1,146 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrShuttingDown is returned by the package-level functions once Shutdown was called
+var ErrShuttingDown = errors.New("dbx: shutting down")
+
+var shuttingDown atomic.Bool
+
+// ShutdownReport describes the work Shutdown had to abort
+type ShutdownReport struct {
+	Canceled         []string // statements canceled with pg_cancel_backend
+	AbortedTxs       int      // transactions still open when the connection was closed, rolled back by the server
+	StoppedListeners int
+	DeadlineExceeded bool // ctx ended before all work finished
+}
+
+// Shutdown gracefully closes the package-level connection.
+//
+// It makes the package-level functions fail with ErrShuttingDown, stops the health checker
+// and all Listeners, and waits for statements in flight and open transactions to finish.
+// When ctx ends first, running statements are canceled with pg_cancel_backend from a separate
+// connection. The connection is then closed, which rolls back any transaction left open.
+func Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	shuttingDown.Store(true)
+	ready.Store(false)
+	StopHealthCheck()
+
+	report := &ShutdownReport{}
+	report.StoppedListeners = stopListeners(ctx)
+
+	connMu.RLock()
+	c, config := conn, connConfig
+	connMu.RUnlock()
+	if c == nil {
+		return report, nil
+	}
+
+	var errs []error
+	if !waitIdle(ctx) {
+		report.DeadlineExceeded = true
+		inFlight, openTx := defaultMetrics.busy()
+		report.AbortedTxs = int(openTx)
+		if inFlight > 0 && !c.IsClosed() {
+			report.Canceled = defaultMetrics.activeSQL()
+			if err := cancelBackend(config, c.PgConn().PID()); err != nil {
+				errs = append(errs, err)
+			}
+			// give the canceled statements a moment to return before the connection is closed under them
+			graceCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			waitIdle(graceCtx)
+			cancel()
+		}
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs = append(errs, c.Close(closeCtx))
+	return report, errors.Join(errs...)
+}
+
+// waitIdle waits until no statement is in flight and no transaction is open, reporting false if ctx ended first
+func waitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if inFlight, openTx := defaultMetrics.busy(); inFlight == 0 && openTx == 0 {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// cancelBackend cancels the statement running on the backend with pid, using a new connection
+func cancelBackend(config *pgx.ConnConfig, pid uint32) error {
+	config = config.Copy()
+	config.Tracer = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer c.Close(ctx)
+	_, err = c.Exec(ctx, "SELECT pg_cancel_backend($1)", int64(pid))
+	return err
+}
+
+// stopListeners closes all listeners and returns how many there were
+func stopListeners(ctx context.Context) int {
+	listenersMu.Lock()
+	ls := make([]*Listener, 0, len(listeners))
+	for l := range listeners {
+		ls = append(ls, l)
+	}
+	listenersMu.Unlock()
+
+	for _, l := range ls {
+		l.Close(ctx)
+	}
+	return len(ls)
+}
+
+// errQuerier is a Querier whose every method fails with err
+type errQuerier struct {
+	err error
+}
+
+func (q errQuerier) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	return nil, q.err
+}
+
+func (q errQuerier) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	return errRow{q.err}
+}
+
+func (q errQuerier) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
+	return CommandTag{}, q.err
+}
+
+func (q errQuerier) Begin(ctx context.Context) (Tx, error) {
+	return nil, q.err
+}
+
+func (q errQuerier) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (Tx, error) {
+	return nil, q.err
+}
+
+func (q errQuerier) CopyFrom(ctx context.Context, tableName Identifier, columnNames []string, rowSrc CopyFromSource) (int64, error) {
+	return 0, q.err
+}
+
+func (q errQuerier) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	return errBatchResults{q.err}
+}
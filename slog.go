@@ -0,0 +1,83 @@
+package dbx
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogOptions configures a SlogHook
+type SlogOptions struct {
+	Level         slog.Leveler  // level for successful statements, default slog.LevelDebug
+	ErrorLevel    slog.Leveler  // level for failed statements, default slog.LevelError
+	SlowLevel     slog.Leveler  // level for slow statements, default slog.LevelWarn
+	SlowThreshold time.Duration // statements taking at least this long are logged at SlowLevel; zero disables
+	RedactArgs    bool          // log the argument count instead of the argument values
+}
+
+// SlogHook is a Hook that logs every statement to a slog.Logger
+type SlogHook struct {
+	logger *slog.Logger
+	opts   SlogOptions
+}
+
+// NewSlogHook returns a hook that logs to logger, or to slog.Default() if logger is nil
+func NewSlogHook(logger *slog.Logger, opts *SlogOptions) *SlogHook {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	h := &SlogHook{logger: logger}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelDebug
+	}
+	if h.opts.ErrorLevel == nil {
+		h.opts.ErrorLevel = slog.LevelError
+	}
+	if h.opts.SlowLevel == nil {
+		h.opts.SlowLevel = slog.LevelWarn
+	}
+	return h
+}
+
+// Before implements Hook
+func (h *SlogHook) Before(ctx context.Context, e *Event) context.Context {
+	return ctx
+}
+
+// After implements Hook
+func (h *SlogHook) After(ctx context.Context, e *Event) {
+	if e.Op == "acquire" && e.Err == nil {
+		return
+	}
+	level, msg := h.opts.Level.Level(), "dbx statement"
+	switch {
+	case e.Err != nil:
+		level, msg = h.opts.ErrorLevel.Level(), "dbx statement failed"
+	case h.opts.SlowThreshold > 0 && e.Duration >= h.opts.SlowThreshold:
+		level, msg = h.opts.SlowLevel.Level(), "dbx slow statement"
+	}
+	if !h.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("op", e.Op),
+		slog.String("sql", e.SQL),
+	}
+	if h.opts.RedactArgs {
+		attrs = append(attrs, slog.Int("args", len(e.Args)))
+	} else {
+		attrs = append(attrs, slog.Any("args", e.Args))
+	}
+	attrs = append(attrs,
+		slog.Int64("rows", e.RowsAffected),
+		slog.Duration("duration", e.Duration),
+	)
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	h.logger.LogAttrs(ctx, level, msg, attrs...)
+}
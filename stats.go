@@ -0,0 +1,173 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the statement latency histogram in DBStats.
+// They are copied into the OpStats of an operation when it is first recorded, so changes only
+// apply to operations recorded afterwards; set them before connecting.
+var LatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DBStats is a snapshot of connection and statement metrics
+type DBStats struct {
+	OpenConns       int32
+	IdleConns       int32
+	AcquiredConns   int32
+	AcquireCount    int64         // pool acquisitions, zero for a single connection
+	AcquireDuration time.Duration // total time spent waiting for pool acquisitions
+	Ops             map[string]OpStats
+	Errors          map[string]int64 // failed statements by SQLSTATE class, "other" for client-side errors
+}
+
+// OpStats holds the metrics of one operation, keyed by Event.Op in DBStats.Ops
+type OpStats struct {
+	Count    int64
+	Errors   int64
+	Duration time.Duration // total time spent
+	Bounds   []float64     // upper bounds of the buckets in seconds, LatencyBuckets when the operation was first recorded
+	Buckets  []int64       // cumulative counts per bound
+}
+
+// metrics is a Hook that aggregates statement metrics and tracks work in progress
+type metrics struct {
+	mu              sync.Mutex
+	inFlight        int32
+	active          map[*Event]struct{} // statements in flight
+	openTx          int32               // transactions begun but not yet committed or rolled back
+	acquireCount    int64
+	acquireDuration time.Duration
+	ops             map[string]*OpStats
+	errors          map[string]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		active: make(map[*Event]struct{}),
+		ops:    make(map[string]*OpStats),
+		errors: make(map[string]int64),
+	}
+}
+
+var defaultMetrics = newMetrics()
+
+func (m *metrics) Before(ctx context.Context, e *Event) context.Context {
+	if e.Op != "acquire" {
+		m.mu.Lock()
+		m.inFlight++
+		m.active[e] = struct{}{}
+		m.mu.Unlock()
+	}
+	return ctx
+}
+
+func (m *metrics) After(ctx context.Context, e *Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e.Op == "acquire" {
+		m.acquireCount++
+		m.acquireDuration += e.Duration
+		return
+	}
+
+	m.inFlight--
+	delete(m.active, e)
+	switch {
+	case e.Op == "begin" && e.Err == nil:
+		m.openTx++
+	case (e.Op == "commit" || e.Op == "rollback") && m.openTx > 0:
+		m.openTx--
+	}
+
+	s, ok := m.ops[e.Op]
+	if !ok {
+		bounds := append([]float64(nil), LatencyBuckets...)
+		s = &OpStats{Bounds: bounds, Buckets: make([]int64, len(bounds))}
+		m.ops[e.Op] = s
+	}
+	s.Count++
+	s.Duration += e.Duration
+	seconds := e.Duration.Seconds()
+	for i, bound := range s.Bounds {
+		if seconds <= bound {
+			s.Buckets[i]++
+		}
+	}
+	if e.Err != nil {
+		s.Errors++
+		m.errors[sqlStateClass(e.Err)]++
+	}
+}
+
+// busy reports the number of statements in flight and of open transactions
+func (m *metrics) busy() (inFlight, openTx int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inFlight, m.openTx
+}
+
+// activeSQL returns the statements in flight
+func (m *metrics) activeSQL() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sqls := make([]string, 0, len(m.active))
+	for e := range m.active {
+		sqls = append(sqls, truncateSQL(e.SQL))
+	}
+	return sqls
+}
+
+// snapshot copies the aggregated metrics into stats
+func (m *metrics) snapshot(stats *DBStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats.AcquireCount = m.acquireCount
+	stats.AcquireDuration = m.acquireDuration
+	stats.Ops = make(map[string]OpStats, len(m.ops))
+	for op, s := range m.ops {
+		c := *s
+		c.Buckets = append([]int64(nil), s.Buckets...)
+		stats.Ops[op] = c
+	}
+	stats.Errors = make(map[string]int64, len(m.errors))
+	for class, n := range m.errors {
+		stats.Errors[class] = n
+	}
+}
+
+func sqlStateClass(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) >= 2 {
+		return pgErr.Code[:2]
+	}
+	return "other"
+}
+
+// Stats returns a snapshot of the package-level connection's metrics,
+// or of the default querier's if it has a Stats method, as *Cluster does
+func Stats() DBStats {
+	defaultMu.RLock()
+	q := defaultQuerier
+	defaultMu.RUnlock()
+	if s, ok := q.(interface{ Stats() DBStats }); ok {
+		return s.Stats()
+	}
+
+	var stats DBStats
+	defaultMetrics.snapshot(&stats)
+	if !IsClosed() {
+		stats.OpenConns = 1
+		if inFlight, _ := defaultMetrics.busy(); inFlight > 0 {
+			stats.AcquiredConns = 1
+		}
+		stats.IdleConns = stats.OpenConns - stats.AcquiredConns
+	}
+	return stats
+}
@@ -0,0 +1,39 @@
+package dbx
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMetricsLatencyBuckets(t *testing.T) {
+	defer func(b []float64) { LatencyBuckets = b }(LatencyBuckets)
+	LatencyBuckets = []float64{.01, .1, 1}
+
+	m := newMetrics()
+	record := func(op string, d time.Duration) {
+		e := &Event{Op: op}
+		ctx := m.Before(context.Background(), e)
+		e.Duration = d
+		m.After(ctx, e)
+	}
+	record("query", 50*time.Millisecond)
+
+	// changing the buckets afterwards must not break the operations already recorded
+	LatencyBuckets = []float64{.001}
+	record("query", 5*time.Millisecond)
+	LatencyBuckets[0] = 10
+	record("exec", 5*time.Millisecond)
+
+	var stats DBStats
+	m.snapshot(&stats)
+	query := stats.Ops["query"]
+	if !slices.Equal(query.Bounds, []float64{.01, .1, 1}) || !slices.Equal(query.Buckets, []int64{1, 2, 2}) {
+		t.Errorf("query bounds %v buckets %v, want [0.01 0.1 1] [1 2 2]", query.Bounds, query.Buckets)
+	}
+	exec := stats.Ops["exec"]
+	if !slices.Equal(exec.Bounds, []float64{10}) || !slices.Equal(exec.Buckets, []int64{1}) {
+		t.Errorf("exec bounds %v buckets %v, want [10] [1]", exec.Bounds, exec.Buckets)
+	}
+}
@@ -0,0 +1,202 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Event describes a single operation observed by a Hook
+type Event struct {
+	Op           string // "query", "query_row", "exec", "get", "select", "insert", "batch", "copy", "begin", "commit", "rollback" or "acquire"
+	SQL          string
+	Args         []any
+	RowsAffected int64
+	Duration     time.Duration // set before After is called
+	Err          error         // set before After is called
+}
+
+// Hook observes every statement sent through a dbx connection
+type Hook interface {
+	// Before is called before the statement is sent; the returned context is passed to After
+	Before(ctx context.Context, e *Event) context.Context
+	// After is called once the statement completed
+	After(ctx context.Context, e *Event)
+}
+
+// Option configures Connect and ConnectConfig
+type Option func(*options)
+
+type options struct {
+	hooks []Hook
+}
+
+// WithHooks installs hooks that observe every statement made on the connection
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+// applyOptions returns a copy of config with a tracer for the metrics and the hooks in opts installed
+func applyOptions(config *pgx.ConnConfig, m *metrics, opts []Option) *pgx.ConnConfig {
+	o := options{hooks: []Hook{m}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	config = config.Copy()
+	config.Tracer = &Tracer{hooks: o.hooks, next: config.Tracer}
+	return config
+}
+
+// Tracer adapts hooks to pgx's tracer interfaces.
+// Connect installs one automatically; use NewTracer to trace connections and pools created outside dbx.
+type Tracer struct {
+	hooks []Hook
+	next  pgx.QueryTracer // tracer that was configured before, if any
+}
+
+// NewTracer returns a pgx tracer that calls hooks for every query, batch and copy.
+// Installed on a pgxpool config it also reports connection acquisition as "acquire" events.
+func NewTracer(hooks ...Hook) *Tracer {
+	return &Tracer{hooks: hooks}
+}
+
+type opKey struct{}
+
+// traceKey keys the state of a statement by Tracer, since a Tracer may wrap another one
+type traceKey struct {
+	t *Tracer
+}
+
+type traceState struct {
+	event *Event
+	start time.Time
+}
+
+// withOp records the dbx operation name for the tracer
+func withOp(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, opKey{}, op)
+}
+
+func opFor(ctx context.Context, sql string) string {
+	switch {
+	case sql == "commit":
+		return "commit"
+	case sql == "rollback":
+		return "rollback"
+	case strings.HasPrefix(sql, "begin"):
+		return "begin"
+	}
+	if op, ok := ctx.Value(opKey{}).(string); ok {
+		return op
+	}
+	return "query"
+}
+
+func (t *Tracer) start(ctx context.Context, e *Event) context.Context {
+	for _, h := range t.hooks {
+		ctx = h.Before(ctx, e)
+	}
+	return context.WithValue(ctx, traceKey{t}, &traceState{event: e, start: time.Now()})
+}
+
+func (t *Tracer) end(ctx context.Context, rowsAffected int64, err error) {
+	state, ok := ctx.Value(traceKey{t}).(*traceState)
+	if !ok {
+		return
+	}
+	e := state.event
+	e.Duration = time.Since(state.start)
+	if rowsAffected > e.RowsAffected {
+		e.RowsAffected = rowsAffected
+	}
+	e.Err = err
+	for i := len(t.hooks) - 1; i >= 0; i-- {
+		t.hooks[i].After(ctx, e)
+	}
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return t.start(ctx, &Event{Op: opFor(ctx, data.SQL), SQL: data.SQL, Args: data.Args})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (t *Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, data.CommandTag.RowsAffected(), data.Err)
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+// TraceBatchStart implements pgx.BatchTracer
+func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	if next, ok := t.next.(pgx.BatchTracer); ok {
+		ctx = next.TraceBatchStart(ctx, conn, data)
+	}
+	var sqls []string
+	if data.Batch != nil {
+		for _, q := range data.Batch.QueuedQueries {
+			sqls = append(sqls, q.SQL)
+		}
+	}
+	return t.start(ctx, &Event{Op: "batch", SQL: strings.Join(sqls, "; ")})
+}
+
+// TraceBatchQuery implements pgx.BatchTracer
+func (t *Tracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if state, ok := ctx.Value(traceKey{t}).(*traceState); ok {
+		state.event.RowsAffected += data.CommandTag.RowsAffected()
+	}
+	if next, ok := t.next.(pgx.BatchTracer); ok {
+		next.TraceBatchQuery(ctx, conn, data)
+	}
+}
+
+// TraceBatchEnd implements pgx.BatchTracer
+func (t *Tracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.end(ctx, 0, data.Err)
+	if next, ok := t.next.(pgx.BatchTracer); ok {
+		next.TraceBatchEnd(ctx, conn, data)
+	}
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer
+func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	if next, ok := t.next.(pgx.CopyFromTracer); ok {
+		ctx = next.TraceCopyFromStart(ctx, conn, data)
+	}
+	sql := "copy " + data.TableName.Sanitize() + " (" + strings.Join(data.ColumnNames, ", ") + ") from stdin"
+	return t.start(ctx, &Event{Op: "copy", SQL: sql})
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer
+func (t *Tracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, data.CommandTag.RowsAffected(), data.Err)
+	if next, ok := t.next.(pgx.CopyFromTracer); ok {
+		next.TraceCopyFromEnd(ctx, conn, data)
+	}
+}
+
+// TraceAcquireStart implements pgxpool.AcquireTracer
+func (t *Tracer) TraceAcquireStart(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireStartData) context.Context {
+	if next, ok := t.next.(pgxpool.AcquireTracer); ok {
+		ctx = next.TraceAcquireStart(ctx, pool, data)
+	}
+	return t.start(ctx, &Event{Op: "acquire"})
+}
+
+// TraceAcquireEnd implements pgxpool.AcquireTracer
+func (t *Tracer) TraceAcquireEnd(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	t.end(ctx, 0, data.Err)
+	if next, ok := t.next.(pgxpool.AcquireTracer); ok {
+		next.TraceAcquireEnd(ctx, pool, data)
+	}
+}
@@ -0,0 +1,35 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TestTracerWrapsTracer traces through a Tracer wrapping another one, as when ConnectConfig is
+// given a config whose tracer was installed by dbx. Each one must see its own statement end.
+func TestTracerWrapsTracer(t *testing.T) {
+	inner, outer := newMetrics(), newMetrics()
+	tracer := &Tracer{hooks: []Hook{outer}, next: &Tracer{hooks: []Hook{inner}}}
+
+	ctx := context.Background()
+	qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	bctx := tracer.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{Batch: &pgx.Batch{}})
+	tracer.TraceBatchQuery(bctx, nil, pgx.TraceBatchQueryData{CommandTag: pgconn.NewCommandTag("UPDATE 2")})
+	tracer.TraceBatchEnd(bctx, nil, pgx.TraceBatchEndData{})
+
+	for name, m := range map[string]*metrics{"inner": inner, "outer": outer} {
+		if inFlight, _ := m.busy(); inFlight != 0 || len(m.activeSQL()) != 0 {
+			t.Errorf("%s: %d in flight, active %q after the statements ended", name, inFlight, m.activeSQL())
+		}
+		var stats DBStats
+		m.snapshot(&stats)
+		if stats.Ops["query"].Count != 1 || stats.Ops["batch"].Count != 1 {
+			t.Errorf("%s: ops %+v, want one query and one batch", name, stats.Ops)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xtdlib/dbx/schema"
+)
+
+// ValidateStruct checks the fields of T mapped by Get, Select and InsertStruct against table:
+// every mapped column must exist, the field type must be scannable from the column type and
+// nullable columns must be mapped to types that can hold NULL, such as pointers or pgtype types.
+// Columns without a field are ignored, as they are when scanning.
+func ValidateStruct[T any](ctx context.Context, table string) error {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("dbx: validate %s: not a struct", t)
+	}
+
+	desc, err := schema.DescribeTable(ctx, querier(ctx), table)
+	if err != nil {
+		return fmt.Errorf("dbx: validate %s: %w", t, err)
+	}
+
+	var problems []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, ok := fieldColumn(field)
+		if !ok {
+			continue
+		}
+		col := desc.Column(name)
+		switch {
+		case col == nil:
+			problems = append(problems, fmt.Sprintf("field %s: column %q does not exist", field.Name, name))
+		case !compatible(field.Type, col.TypeName):
+			problems = append(problems, fmt.Sprintf("field %s: %s cannot hold column %q of type %s", field.Name, field.Type, name, col.Type))
+		case !col.NotNull && !nullable(field.Type):
+			problems = append(problems, fmt.Sprintf("field %s: %s cannot hold NULL from nullable column %q", field.Name, field.Type, name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("dbx: %s does not match table %s: %s", t, table, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+var (
+	textTypes    = []string{"text", "varchar", "bpchar", "char", "name", "citext"}
+	integerTypes = []string{"int2", "int4", "int8", "numeric"}
+	floatTypes   = []string{"float4", "float8", "numeric"}
+	jsonTypes    = []string{"json", "jsonb"}
+
+	// stringTypes are the built-in types scannable into a string. Types not known here,
+	// such as enums and domains, are accepted too.
+	stringTypes = slices.Concat(textTypes, jsonTypes, []string{"uuid", "xml", "inet", "cidr", "macaddr", "numeric"})
+
+	// goTypes lists the column types accepted by types that would otherwise be checked by kind or as a Scanner
+	goTypes = map[reflect.Type][]string{
+		reflect.TypeFor[time.Time]():          {"timestamp", "timestamptz", "date"},
+		reflect.TypeFor[pgtype.Numeric]():     {"numeric"},
+		reflect.TypeFor[pgtype.Text]():        stringTypes,
+		reflect.TypeFor[pgtype.Bool]():        {"bool"},
+		reflect.TypeFor[pgtype.Int2]():        {"int2"},
+		reflect.TypeFor[pgtype.Int4]():        {"int2", "int4"},
+		reflect.TypeFor[pgtype.Int8]():        {"int2", "int4", "int8"},
+		reflect.TypeFor[pgtype.Float4]():      {"float4"},
+		reflect.TypeFor[pgtype.Float8]():      {"float4", "float8"},
+		reflect.TypeFor[pgtype.Date]():        {"date"},
+		reflect.TypeFor[pgtype.Time]():        {"time"},
+		reflect.TypeFor[pgtype.Timestamp]():   {"timestamp"},
+		reflect.TypeFor[pgtype.Timestamptz](): {"timestamptz"},
+		reflect.TypeFor[pgtype.Interval]():    {"interval"},
+		reflect.TypeFor[pgtype.UUID]():        {"uuid"},
+	}
+
+	scannerType = reflect.TypeFor[sql.Scanner]()
+)
+
+// knownType reports whether typeName is one of the built-in types checked by compatible
+func knownType(typeName string) bool {
+	if slices.Contains(stringTypes, typeName) || slices.Contains(integerTypes, typeName) || slices.Contains(floatTypes, typeName) {
+		return true
+	}
+	for _, names := range goTypes {
+		if slices.Contains(names, typeName) {
+			return true
+		}
+	}
+	return slices.Contains([]string{"bool", "bytea", "oid"}, typeName)
+}
+
+// compatible reports whether a value of column type typeName (a pg_type name, "_elem" for arrays) can be scanned into t
+func compatible(t reflect.Type, typeName string) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if names, ok := goTypes[t]; ok {
+		return slices.Contains(names, typeName)
+	}
+	if t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(scannerType) {
+		// custom scanners decide for themselves
+		return true
+	}
+
+	elem, isArray := strings.CutPrefix(typeName, "_")
+	switch t.Kind() {
+	case reflect.String:
+		return slices.Contains(stringTypes, typeName) || !isArray && !knownType(typeName)
+	case reflect.Bool:
+		return typeName == "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return slices.Contains(integerTypes, typeName)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return slices.Contains(integerTypes, typeName) || typeName == "oid"
+	case reflect.Float32, reflect.Float64:
+		return slices.Contains(floatTypes, typeName)
+	case reflect.Array:
+		return t.Elem().Kind() == reflect.Uint8 && t.Len() == 16 && typeName == "uuid"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return typeName == "bytea" || slices.Contains(stringTypes, typeName)
+		}
+		if isArray {
+			return compatible(t.Elem(), elem)
+		}
+		return slices.Contains(jsonTypes, typeName)
+	case reflect.Map, reflect.Struct:
+		return slices.Contains(jsonTypes, typeName)
+	}
+	return false
+}
+
+// nullable reports whether t can hold NULL
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	}
+	// pgtype and sql.Null* types have a Valid field
+	return reflect.PointerTo(t).Implements(scannerType)
+}